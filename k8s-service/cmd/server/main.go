@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
+
 	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/api/server"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/queue"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +23,11 @@ func main() {
 	logger := setupLogger()
 	logger.Infoln("Starting k8s-service v2")
 	cfg := config.ReadConfig()
+
+	// Cancelled on SIGTERM from a rollout or on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	kubeClient, err := kube.GetKubeClient(cfg, logger)
 	if err != nil {
 		logger.Fatalln(err)
@@ -25,7 +38,7 @@ func main() {
 	}
 
 	// Initialize RabbitMQ connection with auto-reconnect capability
-	q, err := queue.Init(cfg.RabbitMQ, logger)
+	q, err := queue.Init(cfg, logger)
 	if err != nil {
 		logger.Fatalln("Failed to connect to RabbitMQ:", err)
 	}
@@ -36,12 +49,23 @@ func main() {
 		logger.Fatalln("Failed to declare RabbitMQ queues:", err)
 	}
 
+	// Report games that end without a result from the game server and track
+	// the running games before taking new ones from the queue
+	kubeClient.SetResultPublisher(q)
+	err = kubeClient.WatchGameJobs(ctx)
+	if err != nil {
+		logger.Fatalln("Failed to watch game jobs:", err)
+	}
+
 	// Start consuming messages
 	err = q.ConsumeGameQueue(logger, kubeClient)
 	if err != nil {
 		logger.Fatalln("Failed to start consuming from queue:", err)
 	}
 
+	// Delete replays and logs past their retention
+	go kubeClient.RunRetentionSweeper(ctx, cfg.RetentionSweepInterval)
+
 	// Log connection status
 	logger.Infof("RabbitMQ connection established: %v", q.ConnectionStatus())
 
@@ -51,17 +75,48 @@ func main() {
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	e.Use(server.Metrics())
 
 	api.RegisterHandlers(e, api.NewStrictHandler(apiServer, nil))
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 
-	// Ensure clean shutdown of RabbitMQ connection
-	defer func() {
-		if err := q.CloseConnection(); err != nil {
-			logger.Errorln("Error closing RabbitMQ connection:", err)
+	// Serve replay uploads and downloads of the local storage backend
+	if handler := kubeClient.StorageHandler(); handler != nil {
+		e.Any(s3.LocalStoragePath+"*", echo.WrapHandler(handler))
+	}
+
+	go func() {
+		if err := e.Start(cfg.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
 		}
 	}()
 
-	logger.Fatal(e.Start(cfg.Addr))
+	<-ctx.Done()
+	stop()
+	logger.Infoln("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Let the delivery being handled finish, unacknowledged messages are
+	// redelivered to the other replicas
+	if err := q.StopConsuming(shutdownCtx); err != nil {
+		logger.Errorln("Failed to stop consuming game queue:", err)
+	}
+	// Log streams never finish on their own, clients reconnect to another replica
+	apiServer.CloseStreams()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Errorln("Failed to shut down HTTP server:", err)
+	}
+	// Finish reporting the games that have just ended, their results are
+	// published on the RabbitMQ connection
+	if err := kubeClient.DrainFinalization(shutdownCtx); err != nil {
+		logger.Errorln("Failed to finish finalizing game jobs:", err)
+	}
+	if err := q.CloseConnection(); err != nil {
+		logger.Errorln("Error closing RabbitMQ connection:", err)
+	}
+	logger.Infoln("Shutdown complete")
 }
 
 func setupLogger() *zap.SugaredLogger {
@@ -40,3 +40,12 @@ app.kubernetes.io/instance: {{ .Release.Name }}
 {{- default "default" .Values.serviceAccount.name -}}
 {{- end -}}
 {{- end -}}
+
+{{/* Maps game priorities to the PriorityClasses created by the chart, as JSON */}}
+{{- define "k8s-service.priorityClasses" -}}
+{{- $classes := dict -}}
+{{- range $priority, $class := .Values.priorityClasses.classes -}}
+{{- $_ := set $classes $priority (printf "%s-%s" (include "k8s-service.fullname" $) $priority) -}}
+{{- end -}}
+{{- toJson $classes -}}
+{{- end -}}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+)
+
+// healthCheckTimeout bounds each check, so a hanging dependency fails the
+// probe instead of timing it out.
+const healthCheckTimeout = 3 * time.Second
+
+// deliveryFailureWindow is how long failed deliveries fail the readiness
+// check if no other delivery succeeds in the meantime.
+const deliveryFailureWindow = 5 * time.Minute
+
+// deliveryFailureThreshold is how many deliveries have to fail in a row
+// before the replica is taken out of the Service. A single bad message
+// fails on every replica and says little about this one.
+const deliveryFailureThreshold = 5
+
+// healthCheck returns details of a passing check, or why it failed.
+type healthCheck func(ctx context.Context) (string, error)
+
+func (s *Server) Livez(ctx context.Context, request api.LivezRequestObject) (api.LivezResponseObject, error) {
+	report := runHealthChecks(ctx, map[api.HealthCheckName]healthCheck{
+		api.Consumer: s.checkConsumerAlive,
+	})
+	if report.Status != api.Ok {
+		return api.Livez503JSONResponse(report), nil
+	}
+	return api.Livez200JSONResponse(report), nil
+}
+
+func (s *Server) Readyz(ctx context.Context, request api.ReadyzRequestObject) (api.ReadyzResponseObject, error) {
+	report := runHealthChecks(ctx, map[api.HealthCheckName]healthCheck{
+		api.Amqp:     s.checkAMQP,
+		api.Consumer: s.checkConsumer,
+		api.Delivery: s.checkDelivery,
+		api.Kubernetes: func(ctx context.Context) (string, error) {
+			return "allowed to create jobs", s.kube.CheckAccess(ctx)
+		},
+		api.Storage: func(ctx context.Context) (string, error) {
+			return "reachable", s.kube.CheckStorage(ctx)
+		},
+	})
+	if report.Status != api.Ok {
+		s.logger.Warnw("Readiness check failed", "checks", report.Checks)
+		return api.Readyz503JSONResponse(report), nil
+	}
+	return api.Readyz200JSONResponse(report), nil
+}
+
+// runHealthChecks runs all checks concurrently and reports them in a stable order.
+func runHealthChecks(ctx context.Context, checks map[api.HealthCheckName]healthCheck) api.HealthReport {
+	order := []api.HealthCheckName{api.Amqp, api.Consumer, api.Delivery, api.Kubernetes, api.Storage}
+	results := make([]api.HealthCheck, len(order))
+
+	var wg sync.WaitGroup
+	for i, name := range order {
+		check, ok := checks[name]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, name, check)
+		}()
+	}
+	wg.Wait()
+
+	report := api.HealthReport{Status: api.Ok, Checks: []api.HealthCheck{}}
+	for _, result := range results {
+		if result.Name == "" {
+			continue
+		}
+		if result.Status != api.Ok {
+			report.Status = api.Failing
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, name api.HealthCheckName, check healthCheck) api.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	message, err := check(ctx)
+	result := api.HealthCheck{
+		Name:       name,
+		Status:     api.Ok,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = api.Failing
+		message = err.Error()
+	}
+	if message != "" {
+		result.Message = stringPtr(message)
+	}
+	return result
+}
+
+func (s *Server) checkAMQP(ctx context.Context) (string, error) {
+	if s.queue == nil || !s.queue.ConnectionStatus() {
+		return "", errors.New("RabbitMQ connection is not healthy")
+	}
+	return "connected", nil
+}
+
+// checkConsumer fails whenever no game is being consumed, also while the
+// connection is restored or k8s-service shuts down.
+func (s *Server) checkConsumer(ctx context.Context) (string, error) {
+	if s.queue == nil {
+		return "", errors.New("no queue configured")
+	}
+	status := s.queue.ConsumerStatus()
+	switch {
+	case status.Closing:
+		return "", errors.New("shutting down")
+	case !status.Running:
+		return "", errors.New("game queue consumer is not running")
+	}
+	return "consuming", nil
+}
+
+// checkConsumerAlive only fails if the consumer has stopped although the
+// connection is open, which the reconnect logic cannot recover from.
+func (s *Server) checkConsumerAlive(ctx context.Context) (string, error) {
+	if s.queue == nil {
+		return "", nil
+	}
+	status := s.queue.ConsumerStatus()
+	if status.Started && status.Connected && !status.Closing && !status.Running {
+		return "", errors.New("game queue consumer stopped while connected")
+	}
+	return "", nil
+}
+
+func (s *Server) checkDelivery(ctx context.Context) (string, error) {
+	if s.queue == nil {
+		return "", errors.New("no queue configured")
+	}
+	status := s.queue.ConsumerStatus()
+	if status.LastFailure != nil && time.Since(status.LastFailureAt) < deliveryFailureWindow {
+		if status.ConsecutiveFailures >= deliveryFailureThreshold {
+			return "", fmt.Errorf("last %d deliveries failed: %w", status.ConsecutiveFailures, status.LastFailure)
+		}
+		return fmt.Sprintf("%d deliveries failed in a row, last: %v", status.ConsecutiveFailures, status.LastFailure), nil
+	}
+	if status.LastDelivery.IsZero() {
+		return "no delivery handled yet", nil
+	}
+	return "last delivery acknowledged at " + status.LastDelivery.UTC().Format(time.RFC3339), nil
+}
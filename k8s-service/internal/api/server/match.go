@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+)
+
+func (s *Server) GetMatchStatus(ctx context.Context, request api.GetMatchStatusRequestObject) (api.GetMatchStatusResponseObject, error) {
+	status, err := s.kube.GetMatchStatus(ctx, request.Id)
+	if err != nil {
+		if errors.Is(err, kube.ErrMatchNotFound) {
+			return api.GetMatchStatus404JSONResponse{
+				NotFoundJSONResponse: api.NotFoundJSONResponse{
+					Error: stringPtr(err.Error()),
+				},
+			}, nil
+		}
+		return api.GetMatchStatus500JSONResponse{
+			InternalServerErrorJSONResponse: api.InternalServerErrorJSONResponse{
+				Error: stringPtr(err.Error()),
+			},
+		}, nil
+	}
+
+	containers := make([]api.ContainerStatus, 0, len(status.Containers))
+	for _, container := range status.Containers {
+		containers = append(containers, api.ContainerStatus{
+			Name:         container.Name,
+			Init:         container.Init,
+			State:        api.ContainerStatusState(container.State),
+			Reason:       optionalString(container.Reason),
+			Message:      optionalString(container.Message),
+			ExitCode:     container.ExitCode,
+			RestartCount: &container.RestartCount,
+			StartedAt:    container.StartedAt,
+			FinishedAt:   container.FinishedAt,
+		})
+	}
+
+	response := api.GetMatchStatus200JSONResponse{
+		Id:             status.GameID,
+		Phase:          api.MatchStatusPhase(status.Phase),
+		Message:        optionalString(status.Message),
+		StartTime:      status.StartTime,
+		CompletionTime: status.CompletionTime,
+		Containers:     containers,
+	}
+	if len(status.BotCommits) > 0 {
+		response.BotCommits = &status.BotCommits
+	}
+	if len(status.BotIDMapping) > 0 {
+		response.BotIdMapping = &status.BotIDMapping
+	}
+	return response, nil
+}
+
+func (s *Server) CancelMatch(ctx context.Context, request api.CancelMatchRequestObject) (api.CancelMatchResponseObject, error) {
+	cancelled, err := s.kube.CancelGame(ctx, request.Id)
+	if err != nil {
+		return api.CancelMatch500JSONResponse{
+			InternalServerErrorJSONResponse: api.InternalServerErrorJSONResponse{
+				Error: stringPtr(err.Error()),
+			},
+		}, nil
+	}
+
+	if !cancelled {
+		return api.CancelMatch200JSONResponse{
+			Message: stringPtr("match has already finished or been cancelled"),
+		}, nil
+	}
+	return api.CancelMatch200JSONResponse{
+		Message: stringPtr("match cancelled"),
+	}, nil
+}
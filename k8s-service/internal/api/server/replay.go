@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+)
+
+func (s *Server) GetReplayOfMatch(ctx context.Context, request api.GetReplayOfMatchRequestObject) (api.GetReplayOfMatchResponseObject, error) {
+	replay, err := s.kube.GetReplay(ctx, request.Id)
+	if err != nil {
+		if errors.Is(err, kube.ErrReplayNotFound) {
+			return api.GetReplayOfMatch404JSONResponse{
+				NotFoundJSONResponse: api.NotFoundJSONResponse{
+					Error: stringPtr(err.Error()),
+				},
+			}, nil
+		}
+		return api.GetReplayOfMatch500JSONResponse{
+			InternalServerErrorJSONResponse: api.InternalServerErrorJSONResponse{
+				Error: stringPtr(err.Error()),
+			},
+		}, nil
+	}
+
+	return api.GetReplayOfMatch200JSONResponse{
+		Url:        replay.URL,
+		Format:     api.ReplayFormat(replay.Format),
+		Size:       replay.Size,
+		UploadedAt: replay.UploadedAt,
+		ExpiresAt:  replay.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+)
+
+func (s *Server) GetRetentionReport(ctx context.Context, request api.GetRetentionReportRequestObject) (api.GetRetentionReportResponseObject, error) {
+	report, err := s.kube.RetentionReport(ctx)
+	if err != nil {
+		return api.GetRetentionReport500JSONResponse{
+			InternalServerErrorJSONResponse: api.InternalServerErrorJSONResponse{
+				Error: stringPtr(err.Error()),
+			},
+		}, nil
+	}
+
+	objects := make([]api.ExpiredObject, 0, len(report.Objects))
+	for _, obj := range report.Objects {
+		objects = append(objects, api.ExpiredObject{
+			Key:          obj.Key,
+			Kind:         api.ExpiredObjectKind(obj.Kind),
+			Class:        obj.Class,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ExpiredAt:    obj.ExpiredAt,
+		})
+	}
+
+	return api.GetRetentionReport200JSONResponse{
+		GeneratedAt: report.GeneratedAt,
+		Objects:     objects,
+		TotalSize:   report.TotalSize,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retention report", func() {
+	var (
+		cfg *config.Config
+		ts  *testServer
+	)
+
+	BeforeEach(func() {
+		cfg = newConfig()
+		cfg.RetentionPolicies = `{"queue": {"logs": "1d"}, "final": {}}`
+		ts = newTestServer(cfg)
+	})
+
+	// uploadLogs stores logs of the class, last modified age ago.
+	uploadLogs := func(retentionClass string, age time.Duration) uuid.UUID {
+		gameID := uuid.New()
+		Expect(ts.s3Client.UploadLogs(context.Background(), gameID, "game", []byte("logs"), retentionClass)).To(Succeed())
+		modified := time.Now().Add(-age)
+		Expect(os.Chtimes(filepath.Join(cfg.LocalStoragePath, gameID.String(), "logs", "game.log"), modified, modified)).To(Succeed())
+		return gameID
+	}
+
+	It("should list expired objects without deleting them", func() {
+		expired := uploadLogs("queue", 48*time.Hour)
+		uploadLogs("queue", time.Hour)
+		uploadLogs("final", 48*time.Hour)
+
+		rec := get(ts.handler, "/v1/retention/report")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var report api.RetentionReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Objects).To(HaveLen(1))
+		Expect(report.Objects[0].Key).To(Equal(expired.String() + "/logs/game.log"))
+		Expect(report.Objects[0].Kind).To(Equal(api.ExpiredObjectKind("logs")))
+		Expect(report.Objects[0].Class).To(Equal("queue"))
+		Expect(report.TotalSize).To(Equal(int64(len("logs"))))
+		Expect(ts.s3Client.GetLogs(context.Background(), expired, "game")).To(Equal("logs"))
+	})
+
+	It("should return an empty list when nothing expired", func() {
+		rec := get(ts.handler, "/v1/retention/report")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`"objects":[]`))
+	})
+
+	It("should fail when the storage cannot be listed", func() {
+		Expect(os.RemoveAll(cfg.LocalStoragePath)).To(Succeed())
+
+		rec := get(ts.handler, "/v1/retention/report")
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).To(ContainSubstring("failed to list objects"))
+	})
+})
@@ -13,15 +13,23 @@ type Server struct {
 	kube   *kube.Client
 	queue  *queue.Queue
 	logger *zap.SugaredLogger
+
+	// streams is cancelled by CloseStreams to end the open log streams.
+	streams      context.Context
+	closeStreams context.CancelFunc
 }
 
 var _ api.StrictServerInterface = (*Server)(nil)
 
 func NewServer(kube *kube.Client, queue *queue.Queue, logger *zap.SugaredLogger) *Server {
+	streams, closeStreams := context.WithCancel(context.Background())
 	return &Server{
 		kube:   kube,
 		queue:  queue,
 		logger: logger,
+
+		streams:      streams,
+		closeStreams: closeStreams,
 	}
 }
 
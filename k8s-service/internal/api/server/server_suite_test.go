@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api/server"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var logger *zap.SugaredLogger
+
+func TestServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Server Suite")
+}
+
+var _ = BeforeSuite(func() {
+	prodLogger, err := zap.NewProduction()
+	Expect(err).ShouldNot(HaveOccurred())
+	logger = prodLogger.Sugar()
+})
+
+// newConfig returns a configuration with local storage in a fresh directory.
+func newConfig() *config.Config {
+	return &config.Config{
+		Namespace:             "coregame",
+		StorageBackend:        s3.BackendLocal,
+		LocalStoragePath:      GinkgoT().TempDir(),
+		LocalStorageURL:       "http://localhost:9000",
+		RetentionDefaultClass: "default",
+	}
+}
+
+// testServer is the API on a kube.Client backed by a fake clientset.
+type testServer struct {
+	handler   http.Handler
+	server    *server.Server
+	clientset *fake.Clientset
+	s3Client  *s3.Client
+}
+
+// newTestServer returns the API with cfg's storage.
+func newTestServer(cfg *config.Config) *testServer {
+	s3Client, err := s3.NewClient(cfg, logger)
+	Expect(err).NotTo(HaveOccurred())
+	clientset := fake.NewSimpleClientset()
+	kubeClient, err := kube.NewClient(clientset, s3Client, cfg, logger)
+	Expect(err).NotTo(HaveOccurred())
+
+	apiServer := server.NewServer(kubeClient, nil, logger)
+	e := echo.New()
+	api.RegisterHandlers(e, api.NewStrictHandler(apiServer, nil))
+	return &testServer{handler: e, server: apiServer, clientset: clientset, s3Client: s3Client}
+}
+
+// get sends a GET request to the handler and returns the recorded response.
+func get(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
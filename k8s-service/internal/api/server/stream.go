@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/api"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+)
+
+const (
+	// streamHeartbeatInterval keeps idle streams from being closed by proxies.
+	streamHeartbeatInterval = 15 * time.Second
+	maxLogLineSize          = 1024 * 1024
+)
+
+// CloseStreams ends the open log streams without an end event, so clients
+// reconnect to another replica. They would keep the HTTP server from shutting
+// down otherwise.
+func (s *Server) CloseStreams() {
+	s.closeStreams()
+}
+
+func (s *Server) StreamLogsOfContainer(ctx context.Context, request api.StreamLogsOfContainerRequestObject) (api.StreamLogsOfContainerResponseObject, error) {
+	if since := request.Params.SinceSeconds; since != nil && *since < 1 {
+		return api.StreamLogsOfContainer400JSONResponse{
+			BadRequestJSONResponse: api.BadRequestJSONResponse{
+				Error: stringPtr("sinceSeconds must be at least 1"),
+			},
+		}, nil
+	}
+	if tail := request.Params.TailLines; tail != nil && *tail < 0 {
+		return api.StreamLogsOfContainer400JSONResponse{
+			BadRequestJSONResponse: api.BadRequestJSONResponse{
+				Error: stringPtr("tailLines must not be negative"),
+			},
+		}, nil
+	}
+
+	// The stream ends with the request or once the server shuts down.
+	ctx, cancel := context.WithCancel(ctx)
+	stopAfter := context.AfterFunc(s.streams, cancel)
+	release := func() {
+		stopAfter()
+		cancel()
+	}
+
+	logs, err := s.kube.StreamLogsOfContainer(ctx, request.Id, request.Params.Container, kube.LogStreamOptions{
+		SinceSeconds: request.Params.SinceSeconds,
+		TailLines:    request.Params.TailLines,
+	})
+	if err != nil {
+		release()
+		if errors.Is(err, kube.ErrMatchNotFound) || errors.Is(err, kube.ErrContainerNotFound) {
+			return api.StreamLogsOfContainer404JSONResponse{
+				NotFoundJSONResponse: api.NotFoundJSONResponse{
+					Error: stringPtr(err.Error()),
+				},
+			}, nil
+		}
+		return api.StreamLogsOfContainer500JSONResponse{
+			InternalServerErrorJSONResponse: api.InternalServerErrorJSONResponse{
+				Error: stringPtr(err.Error()),
+			},
+		}, nil
+	}
+
+	return logEventStream{ctx: ctx, shutdown: s.streams.Done(), release: release, logs: logs}, nil
+}
+
+// logEventStream writes container logs as server-sent events, flushing after
+// every event so clients see lines as soon as they are logged.
+type logEventStream struct {
+	ctx context.Context
+	// shutdown is closed once the server shuts down.
+	shutdown <-chan struct{}
+	// release frees the stream's context once it has ended.
+	release func()
+	logs    io.ReadCloser
+}
+
+// interrupted reports whether the client disconnected or the server is
+// shutting down, in which case the stream ends without an event.
+func (s logEventStream) interrupted() bool {
+	select {
+	case <-s.ctx.Done():
+		return true
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s logEventStream) VisitStreamLogsOfContainerResponse(w http.ResponseWriter) error {
+	defer s.release()
+	defer s.logs.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(s.logs)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			// The client disconnected.
+			return nil
+		case <-s.shutdown:
+			return nil
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+			flush()
+		case line, ok := <-lines:
+			if !ok {
+				if s.interrupted() {
+					return nil
+				}
+				var err error
+				select {
+				case err = <-readErr:
+				default:
+				}
+				if err != nil {
+					writeEvent(w, "error", err.Error())
+				} else {
+					writeEvent(w, "end", "")
+				}
+				flush()
+				return nil
+			}
+			if err := writeEvent(w, "log", line); err != nil {
+				return err
+			}
+			flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event, data string) error {
+	data = strings.ReplaceAll(data, "\r", "")
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Log streams", func() {
+	var (
+		ts     *testServer
+		gameID uuid.UUID
+	)
+
+	BeforeEach(func() {
+		ts = newTestServer(newConfig())
+		gameID = uuid.New()
+
+		jobName := "game-" + gameID.String()
+		Expect(ts.clientset.Tracker().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName + "-abcde",
+				Namespace: "coregame",
+				Labels:    map[string]string{"job-name": jobName},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "game"}}},
+		})).To(Succeed())
+	})
+
+	stream := func() string {
+		rec := get(ts.handler, "/v1/match/"+gameID.String()+"/logs/stream?container=game")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+		return rec.Body.String()
+	}
+
+	It("should end the stream once the container's logs end", func() {
+		body := stream()
+
+		Expect(body).To(ContainSubstring("event: log\ndata: fake logs\n\n"))
+		Expect(body).To(HaveSuffix("event: end\ndata: \n\n"))
+	})
+
+	It("should close streams without an end event on shutdown", func() {
+		ts.server.CloseStreams()
+
+		Expect(stream()).NotTo(ContainSubstring("event: end"))
+	})
+
+	DescribeTable("should reject invalid parameters",
+		func(query string) {
+			rec := get(ts.handler, "/v1/match/"+gameID.String()+"/logs/stream?container=game&"+query)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		},
+		Entry("negative sinceSeconds", "sinceSeconds=-5"),
+		Entry("zero sinceSeconds", "sinceSeconds=0"),
+		Entry("negative tailLines", "tailLines=-1"),
+	)
+
+	DescribeTable("should report missing matches and containers as not found",
+		func(path func() string) {
+			Expect(get(ts.handler, path()).Code).To(Equal(http.StatusNotFound))
+		},
+		Entry("unknown match", func() string { return "/v1/match/" + uuid.NewString() + "/logs/stream?container=game" }),
+		Entry("unknown container", func() string { return "/v1/match/" + gameID.String() + "/logs/stream?container=bot-1" }),
+	)
+
+	It("should report failures of the Kubernetes API as server errors", func() {
+		ts.clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		rec := get(ts.handler, "/v1/match/"+gameID.String()+"/logs/stream?container=game")
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
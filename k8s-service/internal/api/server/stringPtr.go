@@ -3,3 +3,11 @@ package server
 func stringPtr(s string) *string {
 	return &s
 }
+
+// optionalString returns nil for empty strings, so they are omitted from responses.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,22 @@
+package kube
+
+// Annotations k8s-service sets on game Jobs.
+const (
+	// annotationFinalized marks game Jobs whose outcome has been processed, so
+	// a restarted watcher does not report them again.
+	annotationFinalized = "coregame/finalized"
+	// annotationBotRefs holds the requested git ref of every bot as a JSON
+	// object keyed by bot ID.
+	annotationBotRefs = "coregame/bot-refs"
+	// annotationBotCommits holds the commit SHA every bot was built from as a
+	// JSON object keyed by bot ID. It is set once the Job has finished.
+	annotationBotCommits = "coregame/bot-commits"
+	// annotationBotIDMapping holds the bot ID of every RndID passed to the
+	// game server, as JSON object keyed by RndID.
+	annotationBotIDMapping = "coregame/bot-id-mapping"
+	// annotationRetentionClass holds the retention class of the game. It is
+	// set on the Job and its pod, persisted logs are stored with it.
+	annotationRetentionClass = "coregame/retention-class"
+	// annotationSpecHash identifies the game message the Job was created for.
+	annotationSpecHash = "coregame/spec-hash"
+)
@@ -0,0 +1,41 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// botRndIDs returns the RndID of every bot of the game. The IDs are derived
+// from the game ID and the bot's position, so reruns and redeliveries of the
+// same game get the same IDs, and are unique within the game.
+func botRndIDs(gameID uuid.UUID, bots int) []string {
+	ids := make([]string, 0, bots)
+	used := make(map[string]bool, bots)
+
+	for index := 0; index < bots; index++ {
+		for attempt := uint32(0); ; attempt++ {
+			id := deriveRndID(gameID, uint32(index), attempt)
+			if !used[id] {
+				used[id] = true
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// deriveRndID hashes the game ID, the bot's index and the attempt into a
+// 16 bit decimal ID. Colliding IDs are resolved by increasing the attempt.
+func deriveRndID(gameID uuid.UUID, index, attempt uint32) string {
+	input := make([]byte, 0, len(gameID)+8)
+	input = append(input, gameID[:]...)
+	input = binary.BigEndian.AppendUint32(input, index)
+	input = binary.BigEndian.AppendUint32(input, attempt)
+
+	sum := sha256.Sum256(input)
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint16(sum[:2])), 10)
+}
@@ -0,0 +1,289 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// rerunDeleteTimeout bounds how long a rerun waits for the previous Job to be deleted.
+const rerunDeleteTimeout = 2 * time.Minute
+
+const (
+	// cancelledGamePrefix names the ConfigMaps recording cancelled games. They
+	// are shared by all replicas.
+	cancelledGamePrefix = "cancelled-game-"
+	// labelCancelledGame selects the ConfigMaps of cancelled games.
+	labelCancelledGame = "coregame/cancelled-game"
+	// cancelledGameTTL is how long the cancellation of a game is remembered.
+	cancelledGameTTL = 24 * time.Hour
+	// cancelledAtKey holds the time a cancellation was recorded.
+	cancelledAtKey = "cancelledAt"
+	// cancellationPublishedKey is set once game_cancelled has been published.
+	cancellationPublishedKey = "published"
+)
+
+// CancelGame deletes the game's Job together with its pod and publishes a
+// PatternGameCancelled result. A game without a Job is recorded as cancelled,
+// so it is skipped once its message is consumed. It reports whether the game
+// was cancelled; Jobs that are being deleted or finished are left alone.
+//
+// The cancellation is recorded before the Job is deleted and marked once it
+// has been published, so a call that failed half-way can simply be repeated.
+func (c *Client) CancelGame(ctx context.Context, gameID uuid.UUID) (bool, error) {
+	jobName := gameJobPrefix + gameID.String()
+
+	record, err := c.cancellation(ctx, gameID)
+	if err != nil {
+		return false, err
+	}
+	if record != nil {
+		return c.resumeCancellation(ctx, gameID, record)
+	}
+
+	job, err := c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return c.cancelScheduledGame(ctx, gameID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job.DeletionTimestamp != nil {
+		return false, nil
+	}
+	if _, finished := jobOutcome(job); finished {
+		return false, nil
+	}
+
+	// Keep the logs of what ran so far, deleting the Job removes the pod.
+	if pod, err := c.gamePod(ctx, jobName); err == nil && pod != nil {
+		if err := c.persistLogs(ctx, gameID, pod); err != nil {
+			c.logger.Warnw("Failed to persist logs of cancelled game", "gameID", gameID, "error", err)
+		}
+	}
+
+	record, created, err := c.recordCancellation(ctx, gameID)
+	if err != nil || !created {
+		return false, err
+	}
+	if err := c.deleteGameJob(ctx, jobName); err != nil {
+		return false, err
+	}
+	c.logger.Infoln("Game job cancelled", "jobName", jobName)
+	return true, c.publishCancellation(ctx, gameID, record)
+}
+
+// cancelScheduledGame records the cancellation of a game whose Job does not
+// exist, either because it is still waiting in the queue or because it has
+// not been consumed yet.
+func (c *Client) cancelScheduledGame(ctx context.Context, gameID uuid.UUID) (bool, error) {
+	record, created, err := c.recordCancellation(ctx, gameID)
+	if err != nil || !created {
+		return false, err
+	}
+	c.logger.Infoln("Game cancelled before it was scheduled", "gameID", gameID)
+	c.pruneCancelledGames(ctx)
+
+	return true, c.publishCancellation(ctx, gameID, record)
+}
+
+// resumeCancellation finishes a cancellation that was recorded before. Once
+// game_cancelled has been published there is nothing left to do; otherwise
+// the Job, if it is still running, is deleted and the result published again.
+func (c *Client) resumeCancellation(ctx context.Context, gameID uuid.UUID, record *corev1.ConfigMap) (bool, error) {
+	if record.Data[cancellationPublishedKey] == "true" {
+		return false, nil
+	}
+
+	jobName := gameJobPrefix + gameID.String()
+	job, err := c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, jobName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return false, fmt.Errorf("failed to get job: %w", err)
+	case job.DeletionTimestamp != nil:
+	default:
+		if _, finished := jobOutcome(job); finished {
+			// The game ended before the cancellation took effect.
+			return false, c.forgetCancellation(ctx, gameID)
+		}
+		if err := c.deleteGameJob(ctx, jobName); err != nil {
+			return false, err
+		}
+	}
+
+	c.logger.Infoln("Resuming cancellation of game", "gameID", gameID)
+	return true, c.publishCancellation(ctx, gameID, record)
+}
+
+// recordCancellation creates the ConfigMap recording the cancellation of the
+// game. It reports false if another call recorded it first.
+func (c *Client) recordCancellation(ctx context.Context, gameID uuid.UUID) (*corev1.ConfigMap, bool, error) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cancelledGamePrefix + gameID.String(),
+			Namespace: c.namespace,
+			Labels: map[string]string{
+				labelCancelledGame: "true",
+			},
+		},
+		Data: map[string]string{
+			cancelledAtKey: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	created, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record cancellation: %w", err)
+	}
+	return created, true, nil
+}
+
+// forgetCancellation deletes the record of the game's cancellation.
+func (c *Client) forgetCancellation(ctx context.Context, gameID uuid.UUID) error {
+	err := c.clientset.CoreV1().ConfigMaps(c.namespace).Delete(ctx, cancelledGamePrefix+gameID.String(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete cancellation: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) deleteGameJob(ctx context.Context, jobName string) error {
+	propagation := metav1.DeletePropagationForeground
+	err := c.clientset.BatchV1().Jobs(c.namespace).Delete(ctx, jobName, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil
+}
+
+// publishCancellation publishes game_cancelled and marks the record as
+// published. If either fails, the cancellation is published again by the
+// next call; consumers may see game_cancelled more than once.
+func (c *Client) publishCancellation(ctx context.Context, gameID uuid.UUID, record *corev1.ConfigMap) error {
+	if c.results == nil {
+		return fmt.Errorf("no result publisher configured")
+	}
+	err := c.results.PublishResult(ctx, PatternGameCancelled, GameFailure{
+		GameID:     gameID,
+		EndReason:  EndReasonCancelled,
+		Message:    "match was cancelled",
+		FinishedAt: cancelledAt(record),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish game cancellation: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"data": map[string]string{
+			cancellationPublishedKey: "true",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancellation patch: %w", err)
+	}
+	_, err = c.clientset.CoreV1().ConfigMaps(c.namespace).Patch(ctx, record.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to mark cancellation as published: %w", err)
+	}
+	observeMatchOutcome(EndReasonCancelled)
+	return nil
+}
+
+// GameCancelled reports whether the game has been cancelled.
+func (c *Client) GameCancelled(ctx context.Context, gameID uuid.UUID) (bool, error) {
+	record, err := c.cancellation(ctx, gameID)
+	return record != nil, err
+}
+
+// cancellation returns the record of the game's cancellation, or nil if it
+// was not cancelled within cancelledGameTTL.
+func (c *Client) cancellation(ctx context.Context, gameID uuid.UUID) (*corev1.ConfigMap, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, cancelledGamePrefix+gameID.String(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up cancellation: %w", err)
+	}
+	if time.Since(cancelledAt(configMap)) >= cancelledGameTTL {
+		return nil, nil
+	}
+	return configMap, nil
+}
+
+// cancelledAt returns when a cancellation was recorded, falling back to the
+// ConfigMap's creation time.
+func cancelledAt(configMap *corev1.ConfigMap) time.Time {
+	if at, err := time.Parse(time.RFC3339, configMap.Data[cancelledAtKey]); err == nil {
+		return at
+	}
+	return configMap.CreationTimestamp.Time
+}
+
+// pruneCancelledGames deletes the cancellations older than cancelledGameTTL.
+func (c *Client) pruneCancelledGames(ctx context.Context) {
+	configMaps, err := c.clientset.CoreV1().ConfigMaps(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelCancelledGame,
+	})
+	if err != nil {
+		c.logger.Warnw("Failed to list cancelled games", "error", err)
+		return
+	}
+	for _, configMap := range configMaps.Items {
+		if time.Since(cancelledAt(&configMap)) < cancelledGameTTL {
+			continue
+		}
+		err := c.clientset.CoreV1().ConfigMaps(c.namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			c.logger.Warnw("Failed to delete expired cancellation", "name", configMap.Name, "error", err)
+		}
+	}
+}
+
+// RerunGame deletes the game's Job, whether it is still running or has
+// finished, waits until it is gone and schedules the game again. The game is
+// run even if it was cancelled before.
+func (c *Client) RerunGame(ctx context.Context, game *Game) error {
+	jobName := gameJobPrefix + game.ID.String()
+
+	// A rerun supersedes an earlier cancellation.
+	if err := c.forgetCancellation(ctx, game.ID); err != nil {
+		return fmt.Errorf("%w: %w", ErrCreateJobFailed, err)
+	}
+	if err := c.deleteGameJob(ctx, jobName); err != nil {
+		return fmt.Errorf("%w: failed to delete previous job: %w", ErrCreateJobFailed, err)
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, time.Second, rerunDeleteTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrJobTerminating, jobName, err)
+	}
+
+	// The previous Job no longer counts, so the rerun may have to wait for a slot.
+	c.capacity.release(jobName)
+	if err := c.WaitForCapacity(ctx); err != nil {
+		return err
+	}
+
+	c.logger.Infoln("Previous game job removed, scheduling rerun", "jobName", jobName)
+	return c.CreateGameJob(game)
+}
@@ -0,0 +1,191 @@
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Cancel", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		results   *fakePublisher
+		game      kube.Game
+	)
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+		results = &fakePublisher{}
+		client.SetResultPublisher(results)
+		game = newGame()
+	})
+
+	getJob := func() (*batchv1.Job, error) {
+		return clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+	}
+
+	updateJob := func(update func(job *batchv1.Job)) {
+		job, err := getJob()
+		Expect(err).NotTo(HaveOccurred())
+		update(job)
+		Expect(clientset.Tracker().Update(batchv1.SchemeGroupVersion.WithResource("jobs"), job, namespace)).To(Succeed())
+	}
+
+	cancelled := func() bool {
+		cancelled, err := client.GameCancelled(context.Background(), game.ID)
+		Expect(err).NotTo(HaveOccurred())
+		return cancelled
+	}
+
+	It("should delete a running game and publish the cancellation", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+
+		_, err := getJob()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternGameCancelled}))
+		failure := results.Result(kube.PatternGameCancelled).(kube.GameFailure)
+		Expect(failure.GameID).To(Equal(game.ID))
+		Expect(failure.EndReason).To(Equal(kube.EndReasonCancelled))
+	})
+
+	It("should publish the cancellation again after the job was deleted", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+		results.err = errors.New("connection closed")
+
+		_, err := client.CancelGame(context.Background(), game.ID)
+		Expect(err).To(HaveOccurred())
+		_, err = getJob()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		results.err = nil
+		Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternGameCancelled}))
+	})
+
+	It("should delete the job when resuming a cancellation recorded before it", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+		Expect(clientset.Tracker().Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cancelled-game-" + game.ID.String(),
+				Namespace: namespace,
+				Labels:    map[string]string{"coregame/cancelled-game": "true"},
+			},
+			Data: map[string]string{"cancelledAt": time.Now().UTC().Format(time.RFC3339)},
+		})).To(Succeed())
+
+		Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+		_, err := getJob()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternGameCancelled}))
+	})
+
+	It("should leave a job that is being deleted alone", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+		updateJob(func(job *batchv1.Job) {
+			now := metav1.NewTime(time.Now())
+			job.DeletionTimestamp = &now
+		})
+
+		Expect(client.CancelGame(context.Background(), game.ID)).To(BeFalse())
+		Expect(results.Patterns()).To(BeEmpty())
+	})
+
+	It("should leave a finished game alone", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+		updateJob(func(job *batchv1.Job) {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		})
+
+		Expect(client.CancelGame(context.Background(), game.ID)).To(BeFalse())
+		_, err := getJob()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results.Patterns()).To(BeEmpty())
+	})
+
+	Describe("games without a job", func() {
+		It("should record the cancellation once and publish it", func() {
+			Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+			Expect(cancelled()).To(BeTrue())
+			Expect(results.Patterns()).To(Equal([]string{kube.PatternGameCancelled}))
+
+			Expect(client.CancelGame(context.Background(), game.ID)).To(BeFalse())
+			Expect(results.Patterns()).To(HaveLen(1))
+		})
+
+		It("should publish the cancellation again if publishing failed", func() {
+			results.err = errors.New("connection closed")
+			_, err := client.CancelGame(context.Background(), game.ID)
+			Expect(err).To(HaveOccurred())
+			Expect(cancelled()).To(BeTrue())
+
+			results.err = nil
+			Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+			Expect(results.Patterns()).To(Equal([]string{kube.PatternGameCancelled}))
+
+			Expect(client.CancelGame(context.Background(), game.ID)).To(BeFalse())
+			Expect(results.Patterns()).To(HaveLen(1))
+		})
+
+		It("should forget cancellations past their TTL", func() {
+			Expect(clientset.Tracker().Add(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cancelled-game-" + game.ID.String(),
+					Namespace: namespace,
+					Labels:    map[string]string{"coregame/cancelled-game": "true"},
+				},
+				Data: map[string]string{"cancelledAt": time.Now().Add(-25 * time.Hour).UTC().Format(time.RFC3339)},
+			})).To(Succeed())
+			Expect(cancelled()).To(BeFalse())
+
+			other := newGame()
+			Expect(client.CancelGame(context.Background(), other.ID)).To(BeTrue())
+			configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.Background(), metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMaps.Items).To(HaveLen(1))
+			Expect(configMaps.Items[0].Name).To(Equal("cancelled-game-" + other.ID.String()))
+		})
+	})
+
+	Describe("rerun", func() {
+		It("should schedule a game without a previous job", func() {
+			Expect(client.RerunGame(context.Background(), &game)).To(Succeed())
+
+			_, err := getJob()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should replace the job of a finished game", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+			updateJob(func(job *batchv1.Job) {
+				job.Annotations["coregame/finalized"] = "true"
+			})
+
+			Expect(client.RerunGame(context.Background(), &game)).To(Succeed())
+
+			job, err := getJob()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Annotations).NotTo(HaveKey("coregame/finalized"))
+		})
+
+		It("should run a game that was cancelled before", func() {
+			Expect(client.CancelGame(context.Background(), game.ID)).To(BeTrue())
+
+			Expect(client.RerunGame(context.Background(), &game)).To(Succeed())
+			Expect(cancelled()).To(BeFalse())
+			_, err := getJob()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// capacity tracks the running game Jobs, so no more than max games are
+// scheduled at once. It is fed by the game Job informer.
+type capacity struct {
+	max int
+
+	mu      sync.Mutex
+	running map[string]struct{}
+	synced  bool
+	// changed is closed and replaced whenever a slot may have become free.
+	changed chan struct{}
+}
+
+func newCapacity(max int) *capacity {
+	return &capacity{
+		max:     max,
+		running: map[string]struct{}{},
+		changed: make(chan struct{}),
+	}
+}
+
+// broadcast wakes up everyone waiting for a free slot. It must be called with mu held.
+func (c *capacity) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// observe updates the running games from a Job the informer has seen.
+func (c *capacity) observe(job *batchv1.Job) {
+	if !strings.HasPrefix(job.Name, gameJobPrefix) {
+		return
+	}
+	_, finished := jobOutcome(job)
+	if finished || job.DeletionTimestamp != nil {
+		c.release(job.Name)
+		return
+	}
+	c.reserve(job.Name)
+}
+
+// reserve counts the Job as running.
+func (c *capacity) reserve(jobName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.running[jobName] = struct{}{}
+	metrics.RunningGames.Set(float64(len(c.running)))
+}
+
+// release frees the slot of the Job.
+func (c *capacity) release(jobName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.running[jobName]; ok {
+		delete(c.running, jobName)
+		metrics.RunningGames.Set(float64(len(c.running)))
+		c.broadcast()
+	}
+}
+
+func (c *capacity) markSynced() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.synced = true
+	c.broadcast()
+}
+
+func (c *capacity) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.running)
+}
+
+// wait blocks until fewer than max games are running. Until the informer has
+// synced the running games are unknown, so it waits for that as well.
+func (c *capacity) wait(ctx context.Context) error {
+	if c.max <= 0 {
+		return nil
+	}
+	for {
+		c.mu.Lock()
+		free := c.synced && len(c.running) < c.max
+		changed := c.changed
+		c.mu.Unlock()
+
+		if free {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *capacity) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if job, ok := obj.(*batchv1.Job); ok {
+				c.observe(job)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if job, ok := obj.(*batchv1.Job); ok {
+				c.observe(job)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if job, ok := obj.(*batchv1.Job); ok {
+				c.release(job.Name)
+			}
+		},
+	}
+}
+
+// WaitForCapacity blocks until fewer than MAX_CONCURRENT_GAMES games are
+// running. Without a limit it returns immediately. It gives up with
+// ErrNoCapacity once CAPACITY_WAIT has passed.
+func (c *Client) WaitForCapacity(ctx context.Context) error {
+	wait := c.cfg.CapacityWait
+	if wait <= 0 {
+		return c.capacity.wait(ctx)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	err := c.capacity.wait(waitCtx)
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: %d games running after waiting %s", ErrNoCapacity, c.capacity.count(), wait)
+	}
+	return err
+}
+
+// RunningGames returns the number of game Jobs that have not finished yet.
+func (c *Client) RunningGames() int {
+	return c.capacity.count()
+}
@@ -0,0 +1,122 @@
+package kube_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Capacity", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+	)
+
+	hasCapacity := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return client.WaitForCapacity(ctx)
+	}
+
+	It("should not wait without a limit", func() {
+		client, _ = newFakeClient()
+		Expect(hasCapacity()).To(Succeed())
+	})
+
+	Context("with a limit of one game", func() {
+		BeforeEach(func() {
+			limited := *cfg
+			limited.MaxConcurrentGames = 1
+			client, clientset = newFakeClientWithConfig(&limited)
+		})
+
+		It("should wait until the running games are known", func() {
+			Expect(hasCapacity()).To(MatchError(context.DeadlineExceeded))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			Expect(client.WatchGameJobs(ctx)).To(Succeed())
+			Expect(hasCapacity()).To(Succeed())
+		})
+
+		Context("while watching game jobs", func() {
+			var game kube.Game
+
+			BeforeEach(func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				DeferCleanup(cancel)
+				Expect(client.WatchGameJobs(ctx)).To(Succeed())
+
+				game = newGame()
+				Expect(client.CreateGameJob(&game)).To(Succeed())
+				Expect(client.RunningGames()).To(Equal(1))
+			})
+
+			It("should wait for a slot while the game is running", func() {
+				Expect(hasCapacity()).To(MatchError(context.DeadlineExceeded))
+			})
+
+			It("should free the slot once the game has finished", func() {
+				jobs := clientset.BatchV1().Jobs(namespace)
+				job, err := jobs.Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+					Type:   batchv1.JobFailed,
+					Status: corev1.ConditionTrue,
+				})
+				_, err = jobs.UpdateStatus(context.Background(), job, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(hasCapacity).Should(Succeed())
+				Expect(client.RunningGames()).To(BeZero())
+			})
+
+			It("should free the slot once the job is deleted", func() {
+				Expect(clientset.BatchV1().Jobs(namespace).Delete(context.Background(), "game-"+game.ID.String(), metav1.DeleteOptions{})).To(Succeed())
+
+				Eventually(hasCapacity).Should(Succeed())
+			})
+
+			It("should count jobs of other games", func() {
+				other := newGame()
+				Expect(client.CreateGameJob(&other)).To(Succeed())
+				Expect(client.RunningGames()).To(Equal(2))
+			})
+		})
+	})
+
+	Context("with a bounded wait", func() {
+		BeforeEach(func() {
+			limited := *cfg
+			limited.MaxConcurrentGames = 1
+			limited.CapacityWait = 20 * time.Millisecond
+			client, clientset = newFakeClientWithConfig(&limited)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			Expect(client.WatchGameJobs(ctx)).To(Succeed())
+			game := newGame()
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+		})
+
+		It("should give up once no slot became free in time", func() {
+			Expect(client.WaitForCapacity(context.Background())).To(MatchError(kube.ErrNoCapacity))
+		})
+
+		It("should report an interrupted wait as such", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := client.WaitForCapacity(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(err).NotTo(MatchError(kube.ErrNoCapacity))
+		})
+	})
+})
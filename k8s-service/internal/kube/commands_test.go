@@ -0,0 +1,126 @@
+package kube_test
+
+import (
+	"context"
+	"strings"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Commands", func() {
+	envValue := func(container corev1.Container, name string) string {
+		for _, env := range container.Env {
+			if env.Name == name {
+				return env.Value
+			}
+		}
+		return ""
+	}
+
+	DescribeTable("should never put the repository URL into shell code",
+		func(repoURL string) {
+			rndID := "4242"
+			bot := kube.Bot{ID: uuid.New(), RndID: &rndID, RepoURL: repoURL, Ref: repoURL, Image: repoURL}
+
+			clone := kube.NewCloneContainer(bot, "shared-data", corev1.ResourceRequirements{})
+			Expect(clone.Command).To(Equal([]string{"sh", "-c", kube.CloneScript}))
+			Expect(clone.Args).To(BeEmpty())
+			Expect(envValue(clone, "REPO_URL")).To(Equal(repoURL))
+			Expect(envValue(clone, "GIT_REF")).To(Equal(repoURL))
+
+			botContainer := kube.NewBotContainer(bot, "shared-data", kube.DefaultGameType(), corev1.ResourceRequirements{})
+			Expect(botContainer.Command).To(Equal([]string{"sh", "-c", kube.BotScript, "bot"}))
+			Expect(botContainer.Args).To(Equal([]string{"./bot", rndID}))
+			for _, env := range botContainer.Env {
+				Expect(env.Value).NotTo(ContainSubstring(repoURL))
+			}
+		},
+		Entry("command substitution", "https://github.com/org/repo$(touch /tmp/pwned)"),
+		Entry("backticks", "https://github.com/org/`touch /tmp/pwned`"),
+		Entry("command separator", "https://github.com/org/repo; touch /tmp/pwned"),
+		Entry("quote breakout", `https://github.com/org/repo"; touch /tmp/pwned; echo "`),
+		Entry("single quote breakout", "https://github.com/org/repo'; touch /tmp/pwned; echo '"),
+		Entry("newline", "https://github.com/org/repo\ntouch /tmp/pwned"),
+		Entry("pipe", "https://github.com/org/repo | sh"),
+		Entry("option injection", "--upload-pack=touch /tmp/pwned"),
+		Entry("ext transport", "ext::sh -c touch% /tmp/pwned"),
+	)
+
+	It("should not interpolate anything into the scripts", func() {
+		Expect(kube.CloneScript).To(ContainSubstring(`"$REPO_URL"`))
+		Expect(kube.CloneScript).NotTo(ContainSubstring("%"))
+		Expect(kube.BotScript).To(ContainSubstring(`exec "$@"`))
+	})
+
+	Context("with configured game types", func() {
+		var (
+			client    *kube.Client
+			clientset *fake.Clientset
+			game      kube.Game
+		)
+
+		BeforeEach(func() {
+			typed := *cfg
+			typed.GameTypes = `{"rush": {"workingDir": "bots/rush", "build": "cargo build --release", "run": ["./target/release/bot", "--fast"]}}`
+			client, clientset = newFakeClientWithConfig(&typed)
+			game = newGame()
+		})
+
+		botContainers := func() []corev1.Container {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+			job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			var bots []corev1.Container
+			for _, container := range job.Spec.Template.Spec.Containers {
+				if strings.HasPrefix(container.Name, "bot-") {
+					bots = append(bots, container)
+				}
+			}
+			Expect(bots).To(HaveLen(len(game.Bots)))
+			return bots
+		}
+
+		It("should build and run bots of the default type in my-core-bot", func() {
+			for _, container := range botContainers() {
+				Expect(container.WorkingDir).To(Equal("/shared-data/repo/my-core-bot"))
+				Expect(envValue(container, "BOT_BUILD")).To(Equal("make"))
+				Expect(container.Args).To(HaveLen(2))
+				Expect(container.Args[0]).To(Equal("./bot"))
+			}
+		})
+
+		It("should use the game type of the message", func() {
+			game.Type = "rush"
+			for _, container := range botContainers() {
+				Expect(container.WorkingDir).To(Equal("/shared-data/repo/bots/rush"))
+				Expect(envValue(container, "BOT_BUILD")).To(Equal("cargo build --release"))
+				Expect(container.Args[:2]).To(Equal([]string{"./target/release/bot", "--fast"}))
+			}
+		})
+
+		It("should reject unknown game types", func() {
+			game.Type = "chess"
+			Expect(client.CreateGameJob(&game)).To(MatchError(kube.ErrInvalidGame))
+		})
+	})
+
+	DescribeTable("should reject invalid game types",
+		func(gameTypes string) {
+			typed := *cfg
+			typed.GameTypes = gameTypes
+			_, err := kube.NewClient(fake.NewSimpleClientset(), nil, &typed, logger)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("absolute working directory", `{"x": {"workingDir": "/etc", "run": ["./bot"]}}`),
+		Entry("working directory outside the repository", `{"x": {"workingDir": "../..", "run": ["./bot"]}}`),
+		Entry("missing run command", `{"x": {"workingDir": "bot"}}`),
+		Entry("malformed JSON", `{"x":`),
+	)
+})
@@ -1,8 +1,11 @@
 package kube
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
@@ -13,11 +16,33 @@ import (
 )
 
 type Client struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	namespace string
 	logger    *zap.SugaredLogger
 	cfg       *config.Config
 	s3Client  *s3.Client
+	results   ResultPublisher
+	resources *resourcePolicy
+	validator *gameValidator
+	gameTypes map[string]GameType
+	// replayFormat is used for games that do not request a format.
+	replayFormat s3.ReplayFormat
+	retention    *s3.RetentionPolicy
+	capacity     *capacity
+	imagePulls   *imagePulls
+	// priorityClasses maps game priorities to Kubernetes PriorityClass names.
+	priorityClasses map[string]string
+
+	// finalizing holds the names of the game Jobs currently being finalized.
+	finalizing sync.Map
+	// finalizers tracks the finalizations in flight. They run on finalizeCtx
+	// rather than the watch's context, so a shutdown can let them finish.
+	// Once draining is set no new ones are started.
+	finalizers     sync.WaitGroup
+	finalizeCtx    context.Context
+	stopFinalizing context.CancelFunc
+	finalizeMu     sync.Mutex
+	draining       bool
 }
 
 func getKubeConfig(kubePath *string) (*rest.Config, error) {
@@ -40,21 +65,73 @@ func GetKubeClient(config *config.Config, logger *zap.SugaredLogger) (*Client, e
 		return nil, err
 	}
 
-	s3Client, err := s3.NewS3Client(config, logger)
+	s3Client, err := s3.NewClient(config, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	kubeClient := &Client{
-		namespace: config.Namespace,
-		logger:    logger,
-		cfg:       config,
-		s3Client:  s3Client,
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(clientset, s3Client, config, logger)
+}
+
+// NewClient creates a Client on top of an existing clientset.
+func NewClient(clientset kubernetes.Interface, s3Client *s3.Client, config *config.Config, logger *zap.SugaredLogger) (*Client, error) {
+	resources, err := newResourcePolicy(config.ResourcePresets, config.ResourceCeiling)
+	if err != nil {
+		return nil, err
+	}
+	gameTypes, err := newGameTypes(config.GameTypes)
+	if err != nil {
+		return nil, err
 	}
-	kubeClient.clientset, err = kubernetes.NewForConfig(kubeConfig)
+	validator, err := newGameValidator(config, gameTypes)
 	if err != nil {
 		return nil, err
 	}
+	priorityClasses, err := newPriorityClasses(config.PriorityClasses)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := s3.NewRetentionPolicy(config.RetentionPolicies, config.RetentionDefaultClass)
+	if err != nil {
+		return nil, err
+	}
+	replayFormat := s3.ReplayFormatJSON
+	if config.ReplayFormat != "" {
+		if replayFormat, err = s3.ParseReplayFormat(config.ReplayFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	finalizeCtx, stopFinalizing := context.WithCancel(context.Background())
+	return &Client{
+		clientset: clientset,
+		namespace: config.Namespace,
+		logger:    logger,
+		cfg:       config,
+		s3Client:  s3Client,
+		resources: resources,
+		validator: validator,
+		gameTypes: gameTypes,
+
+		replayFormat: replayFormat,
+		retention:    retention,
+		capacity:     newCapacity(config.MaxConcurrentGames),
+		imagePulls:   newImagePulls(),
+
+		priorityClasses: priorityClasses,
+
+		finalizeCtx:    finalizeCtx,
+		stopFinalizing: stopFinalizing,
+	}, nil
+}
 
-	return kubeClient, nil
+// StorageHandler returns the handler serving presigned URLs of the local
+// storage backend, or nil for S3.
+func (c *Client) StorageHandler() http.Handler {
+	return c.s3Client.Handler()
 }
@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Supported kinds of repository credentials.
+const (
+	// CredentialTypeToken is an HTTPS token such as a GitHub App installation
+	// token. The Secret holds it under the "token" key and may set a
+	// "username" (default "x-access-token").
+	CredentialTypeToken = "token"
+	// CredentialTypeSSH is a deploy key stored in a kubernetes.io/ssh-auth
+	// Secret under the "ssh-privatekey" key.
+	CredentialTypeSSH = "ssh"
+)
+
+const (
+	credentialsVolumePrefix = "git-credentials-"
+	credentialsMountPath    = "/git-credentials"
+	credentialsFileMode     = int32(0400)
+)
+
+// BotCredentials reference a Secret in the game namespace used to clone a
+// private bot repository. Only the clone init container ever sees it.
+type BotCredentials struct {
+	SecretName string `json:"secretName"`
+	Type       string `json:"type"`
+}
+
+func (b *BotCredentials) validate() error {
+	if errs := validation.IsDNS1123Subdomain(b.SecretName); len(errs) > 0 {
+		return fmt.Errorf("secretName %q: %s", b.SecretName, strings.Join(errs, ", "))
+	}
+	switch b.Type {
+	case CredentialTypeToken, CredentialTypeSSH:
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %q", b.Type)
+	}
+}
+
+// credentialsVolume returns the Secret volume holding the bot's credentials.
+func credentialsVolume(bot Bot) corev1.Volume {
+	mode := credentialsFileMode
+	return corev1.Volume{
+		Name: credentialsVolumePrefix + bot.ID.String(),
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  bot.Credentials.SecretName,
+				DefaultMode: &mode,
+			},
+		},
+	}
+}
+
+// credentialsEnv configures git in the clone init container to read the
+// credentials from the mounted Secret. The values only contain file paths.
+func credentialsEnv(credentials *BotCredentials) []corev1.EnvVar {
+	switch credentials.Type {
+	case CredentialTypeToken:
+		helper := fmt.Sprintf(`!f() { echo "username=$(cat %[1]s/username 2>/dev/null || echo x-access-token)"; echo "password=$(cat %[1]s/token)"; }; f`,
+			credentialsMountPath)
+		return []corev1.EnvVar{
+			{Name: "GIT_CONFIG_COUNT", Value: "1"},
+			{Name: "GIT_CONFIG_KEY_0", Value: "credential.helper"},
+			{Name: "GIT_CONFIG_VALUE_0", Value: helper},
+		}
+	case CredentialTypeSSH:
+		return []corev1.EnvVar{
+			{
+				Name:  "GIT_SSH_COMMAND",
+				Value: fmt.Sprintf("ssh -i %s/ssh-privatekey -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", credentialsMountPath),
+			},
+		}
+	default:
+		return nil
+	}
+}
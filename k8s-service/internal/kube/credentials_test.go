@@ -0,0 +1,140 @@
+package kube_test
+
+import (
+	"context"
+	"strings"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Credentials", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		game      kube.Game
+	)
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+		game = kube.Game{
+			ID:    uuid.New(),
+			Image: "ghcr.io/42core-team/game-server:dev",
+			Bots: []kube.Bot{
+				{
+					ID:      uuid.New(),
+					Image:   "ghcr.io/42core-team/my-core-bot:dev",
+					RepoURL: "https://github.com/42core-team/private-bot.git",
+					Credentials: &kube.BotCredentials{
+						SecretName: "team-a-token",
+						Type:       kube.CredentialTypeToken,
+					},
+				},
+				{
+					ID:      uuid.New(),
+					Image:   "ghcr.io/42core-team/my-core-bot:dev",
+					RepoURL: "git@github.com:42core-team/private-bot.git",
+					Credentials: &kube.BotCredentials{
+						SecretName: "team-b-deploy-key",
+						Type:       kube.CredentialTypeSSH,
+					},
+				},
+			},
+		}
+	})
+
+	createPodSpec := func() corev1.PodSpec {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return job.Spec.Template.Spec
+	}
+
+	secretVolumes := func(spec corev1.PodSpec) map[string]string {
+		volumes := map[string]string{}
+		for _, volume := range spec.Volumes {
+			if volume.Secret != nil {
+				volumes[volume.Name] = volume.Secret.SecretName
+			}
+		}
+		return volumes
+	}
+
+	It("should mount each bot's secret read-only into its clone container only", func() {
+		spec := createPodSpec()
+		volumes := secretVolumes(spec)
+		Expect(volumes).To(HaveLen(2))
+
+		for _, bot := range game.Bots {
+			volumeName := "git-credentials-" + bot.ID.String()
+			Expect(volumes).To(HaveKeyWithValue(volumeName, bot.Credentials.SecretName))
+
+			var mountedBy []string
+			for _, container := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+				for _, mount := range container.VolumeMounts {
+					if mount.Name == volumeName {
+						Expect(mount.ReadOnly).To(BeTrue())
+						mountedBy = append(mountedBy, container.Name)
+					}
+				}
+			}
+			Expect(mountedBy).To(ConsistOf("clone-repo-" + bot.ID.String()))
+		}
+	})
+
+	It("should never expose a secret to the game or bot containers", func() {
+		spec := createPodSpec()
+		volumes := secretVolumes(spec)
+
+		for _, container := range spec.Containers {
+			Expect(container.EnvFrom).To(BeEmpty(), container.Name)
+			for _, env := range container.Env {
+				Expect(env.ValueFrom).To(BeNil(), container.Name+" "+env.Name)
+				Expect(env.Value).NotTo(ContainSubstring("/git-credentials"), container.Name+" "+env.Name)
+				Expect(strings.HasPrefix(env.Name, "GIT_")).To(BeFalse(), container.Name+" "+env.Name)
+			}
+			for _, mount := range container.VolumeMounts {
+				Expect(volumes).NotTo(HaveKey(mount.Name), container.Name)
+				Expect(mount.MountPath).NotTo(HavePrefix("/git-credentials"), container.Name)
+			}
+		}
+	})
+
+	It("should not reference the secret contents in the clone container", func() {
+		spec := createPodSpec()
+
+		for _, container := range spec.InitContainers {
+			Expect(container.EnvFrom).To(BeEmpty(), container.Name)
+			for _, env := range container.Env {
+				Expect(env.ValueFrom).To(BeNil(), container.Name+" "+env.Name)
+			}
+		}
+	})
+
+	It("should not add secret volumes for public repositories", func() {
+		for i := range game.Bots {
+			game.Bots[i].Credentials = nil
+		}
+
+		spec := createPodSpec()
+		Expect(secretVolumes(spec)).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid credentials",
+		func(credentials kube.BotCredentials) {
+			game.Bots[0].Credentials = &credentials
+
+			err := client.CreateGameJob(&game)
+			Expect(err).To(MatchError(kube.ErrInvalidGame))
+		},
+		Entry("unknown type", kube.BotCredentials{SecretName: "team-a-token", Type: "password"}),
+		Entry("empty secret name", kube.BotCredentials{SecretName: "", Type: kube.CredentialTypeToken}),
+		Entry("invalid secret name", kube.BotCredentials{SecretName: "../team-a", Type: kube.CredentialTypeToken}),
+	)
+})
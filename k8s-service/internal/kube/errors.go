@@ -0,0 +1,28 @@
+package kube
+
+import "errors"
+
+var (
+	// ErrPresignFailed is returned when the replay upload URL could not be generated.
+	ErrPresignFailed = errors.New("failed to generate presigned URL")
+	// ErrCreateJobFailed is returned when Kubernetes rejected the game Job.
+	ErrCreateJobFailed = errors.New("failed to create job")
+	// ErrInvalidResources is returned when a game requests an unknown preset or
+	// resources outside the configured ceiling.
+	ErrInvalidResources = errors.New("invalid game resources")
+	// ErrSpecMismatch is returned when a Job for the game ID already exists but
+	// was created from a different game message.
+	ErrSpecMismatch = errors.New("game already scheduled with a different spec")
+	// ErrJobTerminating is returned when the game's previous Job is still being deleted.
+	ErrJobTerminating = errors.New("game job is still terminating")
+	// ErrMatchNotFound is returned when no game Job exists for a match.
+	ErrMatchNotFound = errors.New("match not found")
+	// ErrContainerNotFound is returned when the game's pod has no container with the requested name.
+	ErrContainerNotFound = errors.New("container not found")
+	// ErrReplayNotFound is returned when the game server has not uploaded the replay of a match.
+	ErrReplayNotFound = errors.New("replay not found")
+	// ErrInvalidGame is returned when a game message is malformed.
+	ErrInvalidGame = errors.New("invalid game")
+	// ErrNoCapacity is returned when no game slot became free within CAPACITY_WAIT.
+	ErrNoCapacity = errors.New("no free game slot")
+)
@@ -0,0 +1,15 @@
+package kube
+
+// Exported for tests that need to build containers from input the validation
+// would reject.
+var (
+	NewCloneContainer = newCloneContainer
+	NewBotContainer   = newBotContainer
+	CloneScript       = cloneScript
+	BotScript         = botScript
+	BotRndIDs         = botRndIDs
+)
+
+func DefaultGameType() GameType {
+	return defaultGameType()
+}
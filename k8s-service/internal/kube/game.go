@@ -2,31 +2,81 @@ package kube
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (c *Client) CreateGameJob(game *Game) error {
-	presignedURL, err := c.s3Client.GeneratePresignedUploadURL(game.ID)
+// Name prefixes of the game Job and its containers.
+const (
+	gameJobPrefix        = "game-"
+	cloneContainerPrefix = "clone-repo-"
+	botContainerPrefix   = "bot-"
+)
+
+// gameContainerName is the name of the game server container.
+const gameContainerName = "game"
+
+// CreateGameJob schedules the game. It is idempotent per game ID: if the Job
+// already exists for the same game message, nothing is done.
+func (c *Client) CreateGameJob(game *Game) (err error) {
+	defer func(start time.Time) {
+		observeCreateGameJob(start, err)
+	}(time.Now())
+
+	return c.createGameJob(game)
+}
+
+func (c *Client) createGameJob(game *Game) error {
+	ctx := context.TODO()
+
+	if err := c.validator.validate(game); err != nil {
+		return err
+	}
+
+	resources, err := c.resources.resolve(game.Resources)
+	if err != nil {
+		return err
+	}
+	gameType := c.gameTypes[game.gameType()]
+
+	jobName := gameJobPrefix + game.ID.String()
+	hash, err := specHash(game)
+	if err != nil {
+		return err
+	}
+	exists, err := c.checkExistingJob(ctx, jobName, hash)
 	if err != nil {
-		return fmt.Errorf("failed to generate presigned URL: %w", err)
+		return err
+	}
+	if exists {
+		c.logger.Infoln("Job for game already exists, skipping", "jobName", jobName)
+		return nil
 	}
 
-	var botIDs []string
+	// The pod may wait for a node and pull images before the deadline starts,
+	// keep the upload URL valid for that time as well.
+	uploadExpiry := time.Duration(resources.deadlineSeconds)*time.Second + c.cfg.ReplayUploadSlack
+	replayFormat := c.replayFormat
+	if game.ReplayFormat != "" {
+		replayFormat = s3.ReplayFormat(game.ReplayFormat)
+	}
+	retentionClass := c.retentionClass(game)
+	upload, err := c.s3Client.GeneratePresignedUploadURL(game.ID, replayFormat, uploadExpiry)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPresignFailed, err)
+	}
+
+	botIDs := botRndIDs(game.ID, len(game.Bots))
 	botIDMapping := make(map[string]string)
-	for ind := range game.Bots {
-		id, err := generateRandomID(2)
-		if err != nil {
-			return fmt.Errorf("error generating rnd IDs for bots %w", err)
-		}
+	for ind, id := range botIDs {
 		game.Bots[ind].RndID = &id
-		botIDs = append(botIDs, id)
 		botIDMapping[id] = game.Bots[ind].ID.String()
 	}
 
@@ -35,115 +85,56 @@ func (c *Client) CreateGameJob(game *Game) error {
 		return fmt.Errorf("failed to marshal bot ID mapping: %w", err)
 	}
 
+	uploadHeaders := make(map[string]string, len(upload.Headers))
+	for name := range upload.Headers {
+		uploadHeaders[name] = upload.Headers.Get(name)
+	}
+	uploadHeadersJSON, err := json.Marshal(uploadHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal replay upload headers: %w", err)
+	}
+
 	var volumes []corev1.Volume
 	var initContainers []corev1.Container
 	var botContainers []corev1.Container
 
 	// Security context helpers
-	botRunAsUser := int64(2000) // untrusted bots
 	//serverRunAsUser := int64(1000) // trusted game server
-	runAsNonRootTrue := true
-	readOnlyRootTrue := true
 	allowPrivilegeEscalationFalse := false
 	automountSATokenFalse := false
 	enableServiceLinksFalse := false
 
-	volumeSizeLimit := resource.MustParse("250Mi")
-
 	for _, bot := range game.Bots {
 		volumeName := "shared-data-" + bot.ID.String()
-		initContainerName := "clone-repo-" + bot.ID.String()
-		containerName := "bot-" + bot.ID.String()
 
 		volumes = append(volumes, corev1.Volume{
 			Name: volumeName,
 			VolumeSource: corev1.VolumeSource{
 				EmptyDir: &corev1.EmptyDirVolumeSource{
-					SizeLimit: &volumeSizeLimit,
+					SizeLimit: &resources.storage,
 				},
 			},
 		})
 
-		initContainers = append(initContainers, corev1.Container{
-			Name:  initContainerName,
-			Image: "alpine/git",
-			Command: []string{
-				"sh", "-c", fmt.Sprintf(`
-					set -eu;
-					echo '--- Cloning repository (verbose, progress) ---';
-					GIT_TERMINAL_PROMPT=0 git clone --single-branch --depth 1 --verbose --progress %s /shared-data/repo;
-					cd /shared-data/repo;
-					echo '--- Last commit ---';
-					git --no-pager log -1 --decorate=short --pretty=fuller;
-					echo '--- Diffstat ---';
-					git --no-pager show --stat -1;
-					echo '--- changing permissions ---'
-					chown -R 2000:2000 /shared-data/repo && chmod -R 770 /shared-data/repo;
-				`, bot.RepoURL),
-			},
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      volumeName,
-					MountPath: "/shared-data",
-				},
-			},
-			//SecurityContext: &corev1.SecurityContext{
-			//	AllowPrivilegeEscalation: &allowPrivilegeEscalationFalse,
-			//	SeccompProfile: &corev1.SeccompProfile{
-			//		Type: corev1.SeccompProfileTypeRuntimeDefault,
-			//	},
-			//	Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
-			//},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse("100m"),
-					corev1.ResourceMemory: resource.MustParse("128Mi"),
-				},
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse("500m"),
-					corev1.ResourceMemory: resource.MustParse("512Mi"),
-				},
-			},
-		})
+		cloneContainer := newCloneContainer(bot, volumeName, resources.clone)
+		// Credentials are only mounted into the clone init container, never into the bot itself.
+		if bot.Credentials != nil {
+			credentials := credentialsVolume(bot)
+			volumes = append(volumes, credentials)
+			cloneContainer.Env = append(cloneContainer.Env, credentialsEnv(bot.Credentials)...)
+			cloneContainer.VolumeMounts = append(cloneContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      credentials.Name,
+				MountPath: credentialsMountPath,
+				ReadOnly:  true,
+			})
+		}
+		initContainers = append(initContainers, cloneContainer)
 
-		botContainers = append(botContainers, corev1.Container{
-			Name:            containerName,
-			Image:           bot.Image,
-			ImagePullPolicy: corev1.PullAlways,
-			Command: []string{
-				"sh", "-c", fmt.Sprintf("cd /shared-data/repo/my-core-bot && make && ./bot %s", *bot.RndID),
-			},
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      volumeName,
-					MountPath: "/shared-data",
-				},
-			},
-			SecurityContext: &corev1.SecurityContext{
-				RunAsUser:                &botRunAsUser,
-				RunAsNonRoot:             &runAsNonRootTrue,
-				AllowPrivilegeEscalation: &allowPrivilegeEscalationFalse,
-				ReadOnlyRootFilesystem:   &readOnlyRootTrue,
-				SeccompProfile: &corev1.SeccompProfile{
-					Type: corev1.SeccompProfileTypeRuntimeDefault,
-				},
-				Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse("250m"),
-					corev1.ResourceMemory: resource.MustParse("256Mi"),
-				},
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse("1"),
-					corev1.ResourceMemory: resource.MustParse("512Mi"),
-				},
-			},
-		})
+		botContainers = append(botContainers, newBotContainer(bot, volumeName, gameType, resources.bot))
 	}
 
 	mainContainer := corev1.Container{
-		Name:  "game",
+		Name:  gameContainerName,
 		Image: game.Image,
 		Args:  botIDs,
 		Env: []corev1.EnvVar{
@@ -161,7 +152,23 @@ func (c *Client) CreateGameJob(game *Game) error {
 			},
 			{
 				Name:  "S3_PRESIGNED_URL",
-				Value: presignedURL,
+				Value: upload.URL,
+			},
+			{
+				Name:  "REPLAY_FORMAT",
+				Value: string(replayFormat),
+			},
+			{
+				Name:  "REPLAY_CONTENT_TYPE",
+				Value: upload.Headers.Get("Content-Type"),
+			},
+			{
+				Name:  "REPLAY_CONTENT_ENCODING",
+				Value: upload.Headers.Get("Content-Encoding"),
+			},
+			{
+				Name:  "REPLAY_UPLOAD_HEADERS",
+				Value: string(uploadHeadersJSON),
 			},
 			{
 				Name:  "UPLOAD_REPLAY",
@@ -181,16 +188,7 @@ func (c *Client) CreateGameJob(game *Game) error {
 			},
 			Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
 		},
-		Resources: corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("500m"),
-				corev1.ResourceMemory: resource.MustParse("512Mi"),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("2"),
-				corev1.ResourceMemory: resource.MustParse("1Gi"),
-			},
-		},
+		Resources: resources.game,
 	}
 
 	// Final init container that installs iptables rules to restrict bot egress to loopback only.
@@ -216,16 +214,7 @@ func (c *Client) CreateGameJob(game *Game) error {
 				Type: corev1.SeccompProfileTypeRuntimeDefault,
 			},
 		},
-		Resources: corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("10m"),
-				corev1.ResourceMemory: resource.MustParse("32Mi"),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("100m"),
-				corev1.ResourceMemory: resource.MustParse("128Mi"),
-			},
-		},
+		Resources: resources.netGuard,
 	})
 
 	podSpec := corev1.PodSpec{
@@ -238,33 +227,176 @@ func (c *Client) CreateGameJob(game *Game) error {
 		HostNetwork:                  false,
 		HostPID:                      false,
 		HostIPC:                      false,
+		PriorityClassName:            c.priorityClasses[game.priority()],
+	}
+
+	botRefs := make(map[string]string)
+	for _, bot := range game.Bots {
+		if bot.Ref != "" {
+			botRefs[bot.ID.String()] = bot.Ref
+		}
+	}
+	botRefsJSON, err := json.Marshal(botRefs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bot refs: %w", err)
 	}
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "game-" + game.ID.String(),
+			Name:      jobName,
 			Namespace: c.namespace,
+			Annotations: map[string]string{
+				annotationBotRefs:        string(botRefsJSON),
+				annotationBotIDMapping:   string(botMappingJSON),
+				annotationRetentionClass: retentionClass,
+				annotationSpecHash:       hash,
+			},
 		},
 		Spec: batchv1.JobSpec{
 			Completions:             int32Ptr(1),
 			BackoffLimit:            int32Ptr(0),
-			ActiveDeadlineSeconds:   int64Ptr(60 * 15),
+			ActiveDeadlineSeconds:   int64Ptr(resources.deadlineSeconds),
 			TTLSecondsAfterFinished: int32Ptr(60 * 60 * 6),
 			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationRetentionClass: retentionClass,
+					},
+				},
 				Spec: podSpec,
 			},
 		},
 	}
 
-	_, err = c.clientset.BatchV1().Jobs(c.namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	_, err = c.clientset.BatchV1().Jobs(c.namespace).Create(ctx, job, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Another delivery of the same message won the race.
+		exists, checkErr := c.checkExistingJob(ctx, jobName, hash)
+		if checkErr != nil {
+			return checkErr
+		}
+		if exists {
+			c.logger.Infoln("Job for game already exists, skipping", "jobName", jobName)
+			return nil
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create job: %v", err)
+		return fmt.Errorf("%w: %w", ErrCreateJobFailed, err)
 	}
+	// Count the game right away, the informer may take a moment to see it.
+	c.capacity.reserve(jobName)
 
 	c.logger.Infoln("Job to run a game successfully created", "jobName", job.Name)
 	return nil
 }
 
+// cloneScript fetches the bot's repository. Its inputs are passed through the
+// environment, so they are never parsed as shell code.
+const cloneScript = `
+set -eu
+echo '--- Fetching repository (verbose, progress) ---'
+mkdir -p /shared-data/repo
+cd /shared-data/repo
+git init -q
+git remote add -- origin "$REPO_URL"
+GIT_TERMINAL_PROMPT=0 git fetch --depth 1 --verbose --progress -- origin "${GIT_REF:-HEAD}"
+git -c advice.detachedHead=false checkout --detach FETCH_HEAD
+git remote remove origin
+echo '--- Last commit ---'
+git --no-pager log -1 --decorate=short --pretty=fuller
+echo '--- Diffstat ---'
+git --no-pager show --stat -1
+echo '--- Recording commit ---'
+git rev-parse HEAD | tee /dev/termination-log
+echo '--- changing permissions ---'
+chown -R 2000:2000 /shared-data/repo && chmod -R 770 /shared-data/repo
+`
+
+// botScript runs the configured build command and then replaces itself with
+// the bot, which is started with the script's arguments.
+const botScript = `
+set -eu
+if [ -n "${BOT_BUILD:-}" ]; then sh -c "$BOT_BUILD"; fi
+exec "$@"
+`
+
+// botRunAsUser is the UID of the untrusted bot containers.
+const botRunAsUser = int64(2000)
+
+func newCloneContainer(bot Bot, volumeName string, resources corev1.ResourceRequirements) corev1.Container {
+	return corev1.Container{
+		Name:    cloneContainerPrefix + bot.ID.String(),
+		Image:   "alpine/git",
+		Command: []string{"sh", "-c", cloneScript},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "REPO_URL",
+				Value: bot.RepoURL,
+			},
+			{
+				Name:  "GIT_REF",
+				Value: bot.Ref,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volumeName,
+				MountPath: "/shared-data",
+			},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		//SecurityContext: &corev1.SecurityContext{
+		//	AllowPrivilegeEscalation: &allowPrivilegeEscalationFalse,
+		//	SeccompProfile: &corev1.SeccompProfile{
+		//		Type: corev1.SeccompProfileTypeRuntimeDefault,
+		//	},
+		//	Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		//},
+		Resources: resources,
+	}
+}
+
+func newBotContainer(bot Bot, volumeName string, gameType GameType, resources corev1.ResourceRequirements) corev1.Container {
+	runAsUser := botRunAsUser
+	runAsNonRootTrue := true
+	readOnlyRootTrue := true
+	allowPrivilegeEscalationFalse := false
+
+	args := append(append([]string{}, gameType.Run...), *bot.RndID)
+
+	return corev1.Container{
+		Name:            botContainerPrefix + bot.ID.String(),
+		Image:           bot.Image,
+		ImagePullPolicy: corev1.PullAlways,
+		Command:         []string{"sh", "-c", botScript, "bot"},
+		Args:            args,
+		WorkingDir:      gameType.workingDir(),
+		Env: []corev1.EnvVar{
+			{
+				Name:  "BOT_BUILD",
+				Value: gameType.Build,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volumeName,
+				MountPath: "/shared-data",
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:                &runAsUser,
+			RunAsNonRoot:             &runAsNonRootTrue,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalationFalse,
+			ReadOnlyRootFilesystem:   &readOnlyRootTrue,
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
+			Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		},
+		Resources: resources,
+	}
+}
+
 func int32Ptr(i int32) *int32 {
 	return &i
 }
@@ -272,16 +404,3 @@ func int32Ptr(i int32) *int32 {
 func int64Ptr(i int64) *int64 {
 	return &i
 }
-
-func generateRandomID(n int) (string, error) {
-	b := make([]byte, n)
-	_, err := rand.Read(b)
-	if err != nil {
-		return "", err
-	}
-	var num uint64
-	for i := 0; i < len(b) && i < 8; i++ {
-		num = (num << 8) | uint64(b[i])
-	}
-	return fmt.Sprintf("%d", num), nil
-}
@@ -0,0 +1,231 @@
+package kube_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Game", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		game      kube.Game
+	)
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+		game = newGame()
+	})
+
+	getJob := func() *batchv1.Job {
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return job
+	}
+
+	countCreates := func() int {
+		creates := 0
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "create" && action.GetResource().Resource == "jobs" {
+				creates++
+			}
+		}
+		return creates
+	}
+
+	It("should create a Job named after the game", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		job := getJob()
+		Expect(job.Annotations).To(HaveKey("coregame/spec-hash"))
+		Expect(job.Spec.Template.Spec.Containers).To(HaveLen(3))
+	})
+
+	It("should store the retention class on the Job and its pod", func() {
+		game.RetentionClass = "final"
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		job := getJob()
+		Expect(job.Annotations).To(HaveKeyWithValue("coregame/retention-class", "final"))
+		Expect(job.Spec.Template.Annotations).To(HaveKeyWithValue("coregame/retention-class", "final"))
+	})
+
+	DescribeTable("should pass the replay upload headers to the game server",
+		func(format, headers string) {
+			game.ReplayFormat = format
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			env := getJob().Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(corev1.EnvVar{Name: "REPLAY_FORMAT", Value: format}))
+			Expect(env).To(ContainElement(And(
+				HaveField("Name", "REPLAY_UPLOAD_HEADERS"),
+				HaveField("Value", MatchJSON(headers)),
+			)))
+		},
+		Entry("json", "json", `{}`),
+		Entry("gzip", "gzip", `{"Content-Type": "application/json", "Content-Encoding": "gzip"}`),
+	)
+
+	Describe("priorities", func() {
+		BeforeEach(func() {
+			prioritized := *cfg
+			prioritized.PriorityClasses = `{"tournament": "coregame-tournament"}`
+			client, clientset = newFakeClientWithConfig(&prioritized)
+		})
+
+		It("should run tournament games with their PriorityClass", func() {
+			game.Priority = kube.PriorityTournament
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			Expect(getJob().Spec.Template.Spec.PriorityClassName).To(Equal("coregame-tournament"))
+		})
+
+		It("should use the cluster default for priorities without a class", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			Expect(getJob().Spec.Template.Spec.PriorityClassName).To(BeEmpty())
+		})
+
+		It("should reject unknown priorities", func() {
+			game.Priority = "urgent"
+			Expect(client.CreateGameJob(&game)).To(MatchError(kube.ErrInvalidGame))
+		})
+
+		It("should reject priority classes of unknown priorities", func() {
+			invalid := *cfg
+			invalid.PriorityClasses = `{"urgent": "coregame-urgent"}`
+			_, err := kube.NewClient(fake.NewSimpleClientset(), nil, &invalid, logger)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should keep the replay upload URL valid for the deadline plus slack", func() {
+		slack := *cfg
+		slack.ReplayUploadSlack = 30 * time.Minute
+		client, clientset = newFakeClientWithConfig(&slack)
+
+		deadline := int64(600)
+		game.Resources = &kube.GameResources{ResourceProfile: kube.ResourceProfile{DeadlineSeconds: deadline}}
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		var uploadURL string
+		for _, env := range getJob().Spec.Template.Spec.Containers[0].Env {
+			if env.Name == "S3_PRESIGNED_URL" {
+				uploadURL = env.Value
+			}
+		}
+		parsed, err := url.Parse(uploadURL)
+		Expect(err).NotTo(HaveOccurred())
+		expires, err := strconv.ParseInt(parsed.Query().Get("expires"), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Unix(expires, 0)).To(BeTemporally("~", time.Now().Add(2400*time.Second), 5*time.Second))
+	})
+
+	Describe("bot IDs", func() {
+		gameArgs := func() []string {
+			return getJob().Spec.Template.Spec.Containers[0].Args
+		}
+
+		It("should pass one unique ID per bot and record the mapping", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			args := gameArgs()
+			Expect(args).To(HaveLen(2))
+			Expect(args[0]).NotTo(Equal(args[1]))
+
+			var mapping map[string]string
+			Expect(json.Unmarshal([]byte(getJob().Annotations["coregame/bot-id-mapping"]), &mapping)).To(Succeed())
+			Expect(mapping).To(Equal(map[string]string{
+				args[0]: game.Bots[0].ID.String(),
+				args[1]: game.Bots[1].ID.String(),
+			}))
+
+			status, err := client.GetMatchStatus(context.Background(), game.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.BotIDMapping).To(Equal(mapping))
+		})
+
+		It("should keep the same IDs when the game is rerun", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+			Expect(kube.BotRndIDs(game.ID, len(game.Bots))).To(Equal(gameArgs()))
+		})
+
+		It("should never assign the same ID twice within a game", func() {
+			for i := 0; i < 5000; i++ {
+				ids := kube.BotRndIDs(uuid.New(), 4)
+				Expect(ids).To(HaveLen(4))
+				seen := map[string]bool{}
+				for _, id := range ids {
+					Expect(seen).NotTo(HaveKey(id))
+					seen[id] = true
+				}
+			}
+		})
+	})
+
+	Describe("idempotency", func() {
+		It("should treat a redelivered message as success without touching the Job", func() {
+			redelivered := game
+			redelivered.Bots = append([]kube.Bot{}, game.Bots...)
+
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+			first := getJob()
+
+			Expect(client.CreateGameJob(&redelivered)).To(Succeed())
+			Expect(countCreates()).To(Equal(1))
+			Expect(getJob().Spec).To(Equal(first.Spec))
+		})
+
+		It("should reject a message with the same ID but a different spec", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			changed := game
+			changed.Bots = append([]kube.Bot{}, game.Bots...)
+			changed.Bots[0].Image = "ghcr.io/42core-team/my-core-bot:other"
+
+			err := client.CreateGameJob(&changed)
+			Expect(err).To(MatchError(kube.ErrSpecMismatch))
+			Expect(countCreates()).To(Equal(1))
+		})
+
+		It("should ask for a retry while the previous Job is being deleted", func() {
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+
+			job := getJob()
+			now := metav1.NewTime(time.Now())
+			job.DeletionTimestamp = &now
+			Expect(clientset.Tracker().Update(batchv1.SchemeGroupVersion.WithResource("jobs"), job, namespace)).To(Succeed())
+
+			err := client.CreateGameJob(&game)
+			Expect(err).To(MatchError(kube.ErrJobTerminating))
+		})
+
+		It("should succeed if a concurrent delivery created the same Job first", func() {
+			clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				// Let the other delivery win: store the Job behind our back, then report the conflict.
+				job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+				Expect(clientset.Tracker().Add(job)).To(Succeed())
+				return true, nil, apierrors.NewAlreadyExists(schema.GroupResource{Group: "batch", Resource: "jobs"}, job.Name)
+			})
+
+			Expect(client.CreateGameJob(&game)).To(Succeed())
+			Expect(getJob().Annotations).To(HaveKey("coregame/spec-hash"))
+		})
+	})
+})
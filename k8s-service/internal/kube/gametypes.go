@@ -0,0 +1,72 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// defaultGameTypeName is used for games that do not set a type. It can be
+// redefined in the configured game types.
+const defaultGameTypeName = "default"
+
+// repoMountPath is where the bot's repository is cloned to.
+const repoMountPath = "/shared-data/repo"
+
+// GameType describes how the bots of a game are built and started.
+type GameType struct {
+	// WorkingDir is the directory inside the repository the bot is built and
+	// run in.
+	WorkingDir string `json:"workingDir"`
+	// Build is run through the shell before the bot is started. It comes from
+	// the configuration only, never from a game message.
+	Build string `json:"build,omitempty"`
+	// Run is the command starting the bot. The bot's RndID is appended as the
+	// last argument.
+	Run []string `json:"run"`
+}
+
+func defaultGameType() GameType {
+	return GameType{
+		WorkingDir: "my-core-bot",
+		Build:      "make",
+		Run:        []string{"./bot"},
+	}
+}
+
+// newGameTypes parses the game types given as JSON in the configuration.
+func newGameTypes(gameTypesJSON string) (map[string]GameType, error) {
+	gameTypes := map[string]GameType{}
+	if gameTypesJSON != "" {
+		if err := json.Unmarshal([]byte(gameTypesJSON), &gameTypes); err != nil {
+			return nil, fmt.Errorf("failed to parse game types: %w", err)
+		}
+	}
+	if _, ok := gameTypes[defaultGameTypeName]; !ok {
+		gameTypes[defaultGameTypeName] = defaultGameType()
+	}
+
+	for name, gameType := range gameTypes {
+		if err := gameType.validate(); err != nil {
+			return nil, fmt.Errorf("game type %q: %w", name, err)
+		}
+	}
+	return gameTypes, nil
+}
+
+func (t GameType) validate() error {
+	dir := path.Clean(t.WorkingDir)
+	if path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+		return fmt.Errorf("workingDir %q must be relative to the repository", t.WorkingDir)
+	}
+	if len(t.Run) == 0 || t.Run[0] == "" {
+		return fmt.Errorf("run command must be set")
+	}
+	return nil
+}
+
+// workingDir returns the absolute working directory of the bot container.
+func (t GameType) workingDir() string {
+	return path.Join(repoMountPath, t.WorkingDir)
+}
@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CheckAccess verifies that the Kubernetes API is reachable and that
+// k8s-service may create game Jobs in its namespace.
+func (c *Client) CheckAccess(ctx context.Context) error {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: c.namespace,
+				Verb:      "create",
+				Group:     "batch",
+				Resource:  "jobs",
+			},
+		},
+	}
+	result, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("kubernetes API unreachable: %w", err)
+	}
+	if !result.Status.Allowed {
+		return fmt.Errorf("not allowed to create jobs in namespace %s: %s", c.namespace, result.Status.Reason)
+	}
+	return nil
+}
+
+// CheckStorage verifies that replay URLs can be signed and the object storage
+// can be accessed.
+func (c *Client) CheckStorage(ctx context.Context) error {
+	return c.s3Client.Check(ctx)
+}
@@ -0,0 +1,55 @@
+package kube_test
+
+import (
+	"context"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		reviewed  *authorizationv1.ResourceAttributes
+	)
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+		reviewed = nil
+	})
+
+	allow := func(allowed bool) {
+		clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			reviewed = review.Spec.ResourceAttributes
+			review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: allowed, Reason: "denied by RBAC"}
+			return true, review, nil
+		})
+	}
+
+	It("should pass if game Jobs may be created", func() {
+		allow(true)
+
+		Expect(client.CheckAccess(context.Background())).To(Succeed())
+		Expect(reviewed.Namespace).To(Equal(namespace))
+		Expect(reviewed.Verb).To(Equal("create"))
+		Expect(reviewed.Group).To(Equal("batch"))
+		Expect(reviewed.Resource).To(Equal("jobs"))
+	})
+
+	It("should fail without RBAC to create Jobs", func() {
+		allow(false)
+
+		Expect(client.CheckAccess(context.Background())).To(MatchError(ContainSubstring("denied by RBAC")))
+	})
+
+	It("should pass if the storage is reachable", func() {
+		Expect(client.CheckStorage(context.Background())).To(Succeed())
+	})
+})
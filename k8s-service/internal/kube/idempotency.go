@@ -0,0 +1,56 @@
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// specHash identifies the game as requested, so a redelivered message can be
+// told apart from a different game reusing the same ID. Values generated
+// while scheduling, like the bots' RndIDs, are not part of it.
+func specHash(game *Game) (string, error) {
+	requested := *game
+	requested.Bots = make([]Bot, len(game.Bots))
+	for i, bot := range game.Bots {
+		bot.RndID = nil
+		requested.Bots[i] = bot
+	}
+
+	spec, err := json.Marshal(requested)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal game spec: %w", err)
+	}
+	sum := sha256.Sum256(spec)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkExistingJob reports whether the game has already been scheduled with
+// the given spec hash. It fails with ErrSpecMismatch if the existing Job was
+// created for a different spec and with ErrJobTerminating if it is being deleted.
+func (c *Client) checkExistingJob(ctx context.Context, jobName, hash string) (bool, error) {
+	job, err := c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: %w", ErrCreateJobFailed, err)
+	}
+	return true, compareExistingJob(job, hash)
+}
+
+func compareExistingJob(job *batchv1.Job, hash string) error {
+	if job.DeletionTimestamp != nil {
+		return fmt.Errorf("%w: %s", ErrJobTerminating, job.Name)
+	}
+	if existing := job.Annotations[annotationSpecHash]; existing != hash {
+		return fmt.Errorf("%w: job %s has spec hash %q, message has %q", ErrSpecMismatch, job.Name, existing, hash)
+	}
+	return nil
+}
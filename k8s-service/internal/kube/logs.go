@@ -2,13 +2,21 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
 	"github.com/google/uuid"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// persistedLogsLimit caps the logs stored per container after a match.
+const persistedLogsLimit = 10 * 1024 * 1024
+
 func (c *Client) GetContainersOfGame(gameID uuid.UUID) ([]string, error) {
 	var containers []string
 
@@ -19,6 +27,11 @@ func (c *Client) GetContainersOfGame(gameID uuid.UUID) ([]string, error) {
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
 
+	// Once the pod is gone, only the logs persisted after the match are left.
+	if len(pods.Items) == 0 {
+		return c.s3Client.ListLogContainers(context.Background(), gameID)
+	}
+
 	for _, pod := range pods.Items {
 		for _, container := range pod.Spec.Containers {
 			containers = append(containers, container.Name)
@@ -29,6 +42,10 @@ func (c *Client) GetContainersOfGame(gameID uuid.UUID) ([]string, error) {
 }
 
 func (c *Client) GetLogsOfContainer(gameID uuid.UUID, containerName string) (*string, error) {
+	if errs := validation.IsDNS1123Label(containerName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid container name %q", containerName)
+	}
+
 	pods, err := c.clientset.CoreV1().Pods(c.namespace).List(context.Background(), metav1.ListOptions{
 		LabelSelector: "job-name=game-" + gameID.String(),
 	})
@@ -37,7 +54,14 @@ func (c *Client) GetLogsOfContainer(gameID uuid.UUID, containerName string) (*st
 	}
 
 	if len(pods.Items) == 0 {
-		return nil, fmt.Errorf("no pods found for game %q", gameID.String())
+		logs, err := c.s3Client.GetLogs(context.Background(), gameID, containerName)
+		if err != nil {
+			if errors.Is(err, s3.ErrNotFound) {
+				return nil, fmt.Errorf("no pods or stored logs found for game %q", gameID.String())
+			}
+			return nil, err
+		}
+		return &logs, nil
 	}
 
 	pod := pods.Items[0]
@@ -55,3 +79,93 @@ func (c *Client) GetLogsOfContainer(gameID uuid.UUID, containerName string) (*st
 	logs := string(logsBytes)
 	return &logs, nil
 }
+
+// persistLogs uploads the logs of every container of the pod, init containers
+// included, so they outlive the Job. Containers that never started have no
+// logs and are skipped. Uploads are keyed by game and container, so a failed
+// call can simply be repeated.
+func (c *Client) persistLogs(ctx context.Context, gameID uuid.UUID, pod *v1.Pod) error {
+	limit := int64(persistedLogsLimit)
+	retentionClass := pod.Annotations[annotationRetentionClass]
+	if retentionClass == "" {
+		retentionClass = c.retention.DefaultClass()
+	}
+
+	for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if !containerStarted(pod, container.Name) {
+			continue
+		}
+
+		logs, err := c.clientset.CoreV1().Pods(c.namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+			Container:  container.Name,
+			LimitBytes: &limit,
+		}).Do(ctx).Raw()
+		if apierrors.IsNotFound(err) {
+			c.logger.Warnw("Pod is gone before its logs were persisted", "gameID", gameID, "container", container.Name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get logs of container %q: %w", container.Name, err)
+		}
+
+		if err := c.s3Client.UploadLogs(ctx, gameID, container.Name, logs, retentionClass); err != nil {
+			return fmt.Errorf("failed to persist logs of container %q: %w", container.Name, err)
+		}
+	}
+	return nil
+}
+
+// containerStarted reports whether the container has run, i.e. whether the
+// kubelet has logs for it.
+func containerStarted(pod *v1.Pod, containerName string) bool {
+	for _, status := range append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if status.Name == containerName {
+			return status.State.Running != nil || status.State.Terminated != nil || status.LastTerminationState.Terminated != nil
+		}
+	}
+	return false
+}
+
+// LogStreamOptions restrict which logs a stream starts with.
+type LogStreamOptions struct {
+	SinceSeconds *int64
+	TailLines    *int64
+}
+
+// StreamLogsOfContainer follows the logs of a container of the game's pod.
+// The stream ends when the container terminates or ctx is cancelled.
+func (c *Client) StreamLogsOfContainer(ctx context.Context, gameID uuid.UUID, containerName string, opts LogStreamOptions) (io.ReadCloser, error) {
+	pod, err := c.gamePod(ctx, gameJobPrefix+gameID.String())
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil {
+		return nil, fmt.Errorf("%w: no pods found for game %q", ErrMatchNotFound, gameID.String())
+	}
+	if !hasContainer(pod, containerName) {
+		return nil, fmt.Errorf("%w: %q in game %q", ErrContainerNotFound, containerName, gameID.String())
+	}
+
+	stream, err := c.clientset.CoreV1().Pods(c.namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container:    containerName,
+		Follow:       true,
+		SinceSeconds: opts.SinceSeconds,
+		TailLines:    opts.TailLines,
+	}).Stream(ctx)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: pod of game %q is gone", ErrMatchNotFound, gameID.String())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream logs: %w", err)
+	}
+	return stream, nil
+}
+
+func hasContainer(pod *v1.Pod, containerName string) bool {
+	for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.Name == containerName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package kube
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// imagePullFailureReasons are the kubelet waiting reasons of an image that
+// cannot be pulled.
+var imagePullFailureReasons = map[string]bool{
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+	"InvalidImageName": true,
+}
+
+// observeCreateGameJob records the duration and the error cause of a
+// CreateGameJob call.
+func observeCreateGameJob(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+		metrics.CreateGameJobErrors.WithLabelValues(createGameJobErrorCause(err)).Inc()
+	}
+	metrics.CreateGameJobDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+func createGameJobErrorCause(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidGame):
+		return "invalid_game"
+	case errors.Is(err, ErrInvalidResources):
+		return "invalid_resources"
+	case errors.Is(err, ErrSpecMismatch):
+		return "spec_mismatch"
+	case errors.Is(err, ErrPresignFailed):
+		return "presign_failed"
+	case errors.Is(err, ErrCreateJobFailed):
+		return "kubernetes_create_failed"
+	default:
+		return "other"
+	}
+}
+
+// observeMatchOutcome counts a finished match.
+func observeMatchOutcome(outcome string) {
+	metrics.MatchOutcomes.WithLabelValues(outcome).Inc()
+}
+
+// imagePulls counts the game containers whose image cannot be pulled, as soon
+// as the kubelet reports it. The kubelet alternates between ErrImagePull and
+// ImagePullBackOff while it retries, so every container is counted once per
+// pod. It is fed by the game pod informer.
+type imagePulls struct {
+	mu sync.Mutex
+	// failed holds the containers counted so far, by pod name.
+	failed map[string]map[string]bool
+}
+
+func newImagePulls() *imagePulls {
+	return &imagePulls{failed: map[string]map[string]bool{}}
+}
+
+// observe counts the containers of the pod that are waiting for an image
+// that cannot be pulled.
+func (p *imagePulls) observe(pod *corev1.Pod) {
+	if !strings.HasPrefix(pod.Labels["job-name"], gameJobPrefix) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		waiting := status.State.Waiting
+		if waiting == nil || !imagePullFailureReasons[waiting.Reason] || p.failed[pod.Name][status.Name] {
+			continue
+		}
+		if p.failed[pod.Name] == nil {
+			p.failed[pod.Name] = map[string]bool{}
+		}
+		p.failed[pod.Name][status.Name] = true
+		metrics.ImagePullFailures.WithLabelValues(waiting.Reason).Inc()
+	}
+}
+
+// forget drops the containers counted for a deleted pod.
+func (p *imagePulls) forget(pod *corev1.Pod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.failed, pod.Name)
+}
+
+func (p *imagePulls) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				p.observe(pod)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				p.observe(pod)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				p.forget(pod)
+			}
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package kube_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+	)
+
+	createJobObservations := func(result string) uint64 {
+		var m dto.Metric
+		observer := metrics.CreateGameJobDuration.WithLabelValues(result).(prometheus.Histogram)
+		Expect(observer.Write(&m)).To(Succeed())
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+	})
+
+	It("should observe created game jobs and count the running games", func() {
+		before := createJobObservations("success")
+
+		game := newGame()
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		Expect(createJobObservations("success")).To(Equal(before + 1))
+		Expect(testutil.ToFloat64(metrics.RunningGames)).To(BeEquivalentTo(client.RunningGames()))
+	})
+
+	It("should count failures by cause", func() {
+		errors := metrics.CreateGameJobErrors.WithLabelValues("invalid_game")
+		before, observed := testutil.ToFloat64(errors), createJobObservations("error")
+
+		game := newGame()
+		game.Priority = "urgent"
+		Expect(client.CreateGameJob(&game)).To(MatchError(kube.ErrInvalidGame))
+
+		Expect(testutil.ToFloat64(errors)).To(Equal(before + 1))
+		Expect(createJobObservations("error")).To(Equal(observed + 1))
+	})
+
+	It("should count image pull failures once per container while the pod waits", func() {
+		imagePullFailures := func() float64 {
+			return testutil.ToFloat64(metrics.ImagePullFailures.WithLabelValues("ErrImagePull")) +
+				testutil.ToFloat64(metrics.ImagePullFailures.WithLabelValues("ImagePullBackOff"))
+		}
+		before := imagePullFailures()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		Expect(client.WatchGameJobs(ctx)).To(Succeed())
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "game-pull-abcde",
+				Namespace: namespace,
+				Labels:    map[string]string{"job-name": "game-pull"},
+			},
+		}
+		setWaiting := func(reason string) {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: "game", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "bot-1", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}},
+			}
+		}
+
+		setWaiting("ContainerCreating")
+		pod, err := clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(imagePullFailures, 100*time.Millisecond).Should(Equal(before))
+
+		for _, reason := range []string{"ErrImagePull", "ImagePullBackOff", "ErrImagePull", "ImagePullBackOff"} {
+			setWaiting(reason)
+			pod, err = clientset.CoreV1().Pods(namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Eventually(imagePullFailures).Should(Equal(before + 1))
+		Consistently(imagePullFailures, 200*time.Millisecond).Should(Equal(before + 1))
+	})
+})
@@ -0,0 +1,47 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Priorities of games. Tournament games are consumed first and may preempt
+// casual games if the cluster is full.
+const (
+	PriorityCasual     = "casual"
+	PriorityTournament = "tournament"
+)
+
+var priorities = []string{PriorityCasual, PriorityTournament}
+
+func (g *Game) priority() string {
+	if g.Priority == "" {
+		return PriorityCasual
+	}
+	return g.Priority
+}
+
+// newPriorityClasses parses the mapping from game priorities to Kubernetes
+// PriorityClass names given as JSON in the configuration. Priorities without
+// a class use the cluster's default.
+func newPriorityClasses(classesJSON string) (map[string]string, error) {
+	classes := map[string]string{}
+	if classesJSON == "" {
+		return classes, nil
+	}
+	if err := json.Unmarshal([]byte(classesJSON), &classes); err != nil {
+		return nil, fmt.Errorf("failed to parse priority classes: %w", err)
+	}
+	for priority, class := range classes {
+		if !slices.Contains(priorities, priority) {
+			return nil, fmt.Errorf("unknown priority %q, must be one of %v", priority, priorities)
+		}
+		if errs := validation.IsDNS1123Subdomain(class); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid priority class %q for %s: %v", class, priority, errs)
+		}
+	}
+	return classes, nil
+}
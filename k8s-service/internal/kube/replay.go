@@ -0,0 +1,47 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/google/uuid"
+)
+
+// Replay is a downloadable replay of a match.
+type Replay struct {
+	URL string
+	// Format is the encoding of the replay: json, gzip or zstd.
+	Format     string
+	Size       int64
+	UploadedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// GetReplay returns a presigned download URL for the game's replay, or
+// ErrReplayNotFound if it has not been uploaded yet.
+func (c *Client) GetReplay(ctx context.Context, gameID uuid.UUID) (*Replay, error) {
+	info, err := c.s3Client.StatReplay(ctx, gameID)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrReplayNotFound, gameID.String())
+		}
+		return nil, err
+	}
+
+	expiry := c.cfg.ReplayURLExpiry
+	url, err := c.s3Client.GeneratePresignedDownloadURL(ctx, info, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Replay{
+		URL:        url,
+		Format:     string(info.Format),
+		Size:       info.Size,
+		UploadedAt: info.UploadedAt,
+		ExpiresAt:  time.Now().Add(expiry),
+	}, nil
+}
@@ -0,0 +1,264 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultPresetName is the preset applied to every game before its own preset
+// and overrides. It can be redefined in the configured presets.
+const defaultPresetName = "default"
+
+// ContainerResources are the requests and limits of a single container,
+// given as Kubernetes quantities (e.g. "500m", "256Mi").
+type ContainerResources struct {
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// ResourceProfile is the resource budget of a game. Empty fields are inherited
+// from the profile it is applied on top of.
+type ResourceProfile struct {
+	Clone    *ContainerResources `json:"clone,omitempty"`
+	Bot      *ContainerResources `json:"bot,omitempty"`
+	Game     *ContainerResources `json:"game,omitempty"`
+	NetGuard *ContainerResources `json:"netGuard,omitempty"`
+	// Storage is the size limit of each bot's shared volume.
+	Storage string `json:"storage,omitempty"`
+	// DeadlineSeconds is the maximum runtime of the game Job.
+	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
+}
+
+// GameResources selects the resource profile of a game: a named preset from
+// the configuration plus per-message overrides.
+type GameResources struct {
+	Preset string `json:"preset,omitempty"`
+	ResourceProfile
+}
+
+// resolvedResources are the validated resources a game Job is created with.
+type resolvedResources struct {
+	clone           corev1.ResourceRequirements
+	bot             corev1.ResourceRequirements
+	game            corev1.ResourceRequirements
+	netGuard        corev1.ResourceRequirements
+	storage         resource.Quantity
+	deadlineSeconds int64
+}
+
+func defaultResourceProfile() ResourceProfile {
+	return ResourceProfile{
+		Clone:           &ContainerResources{CPURequest: "100m", MemoryRequest: "128Mi", CPULimit: "500m", MemoryLimit: "512Mi"},
+		Bot:             &ContainerResources{CPURequest: "250m", MemoryRequest: "256Mi", CPULimit: "1", MemoryLimit: "512Mi"},
+		Game:            &ContainerResources{CPURequest: "500m", MemoryRequest: "512Mi", CPULimit: "2", MemoryLimit: "1Gi"},
+		NetGuard:        &ContainerResources{CPURequest: "10m", MemoryRequest: "32Mi", CPULimit: "100m", MemoryLimit: "128Mi"},
+		Storage:         "250Mi",
+		DeadlineSeconds: 60 * 15,
+	}
+}
+
+func defaultResourceCeiling() ResourceProfile {
+	return ResourceProfile{
+		Clone:           &ContainerResources{CPULimit: "1", MemoryLimit: "1Gi"},
+		Bot:             &ContainerResources{CPULimit: "2", MemoryLimit: "2Gi"},
+		Game:            &ContainerResources{CPULimit: "4", MemoryLimit: "4Gi"},
+		NetGuard:        &ContainerResources{CPULimit: "200m", MemoryLimit: "256Mi"},
+		Storage:         "1Gi",
+		DeadlineSeconds: 60 * 60,
+	}
+}
+
+// merge returns p with every field set in o replaced.
+func (p ResourceProfile) merge(o ResourceProfile) ResourceProfile {
+	p.Clone = p.Clone.merge(o.Clone)
+	p.Bot = p.Bot.merge(o.Bot)
+	p.Game = p.Game.merge(o.Game)
+	p.NetGuard = p.NetGuard.merge(o.NetGuard)
+	if o.Storage != "" {
+		p.Storage = o.Storage
+	}
+	if o.DeadlineSeconds != 0 {
+		p.DeadlineSeconds = o.DeadlineSeconds
+	}
+	return p
+}
+
+func (r *ContainerResources) merge(o *ContainerResources) *ContainerResources {
+	var merged ContainerResources
+	if r != nil {
+		merged = *r
+	}
+	if o == nil {
+		return &merged
+	}
+	if o.CPURequest != "" {
+		merged.CPURequest = o.CPURequest
+	}
+	if o.MemoryRequest != "" {
+		merged.MemoryRequest = o.MemoryRequest
+	}
+	if o.CPULimit != "" {
+		merged.CPULimit = o.CPULimit
+	}
+	if o.MemoryLimit != "" {
+		merged.MemoryLimit = o.MemoryLimit
+	}
+	return &merged
+}
+
+// resourcePolicy holds the configured presets and the ceiling no game may exceed.
+type resourcePolicy struct {
+	presets map[string]ResourceProfile
+	ceiling ResourceProfile
+}
+
+// newResourcePolicy parses the presets and ceiling given as JSON in the
+// configuration and checks that every preset stays below the ceiling.
+func newResourcePolicy(presetsJSON, ceilingJSON string) (*resourcePolicy, error) {
+	policy := &resourcePolicy{
+		presets: map[string]ResourceProfile{},
+		ceiling: defaultResourceCeiling(),
+	}
+
+	if presetsJSON != "" {
+		if err := json.Unmarshal([]byte(presetsJSON), &policy.presets); err != nil {
+			return nil, fmt.Errorf("failed to parse resource presets: %w", err)
+		}
+	}
+	if ceilingJSON != "" {
+		var ceiling ResourceProfile
+		if err := json.Unmarshal([]byte(ceilingJSON), &ceiling); err != nil {
+			return nil, fmt.Errorf("failed to parse resource ceiling: %w", err)
+		}
+		policy.ceiling = policy.ceiling.merge(ceiling)
+	}
+
+	for name := range policy.presets {
+		if _, err := policy.resolve(&GameResources{Preset: name}); err != nil {
+			return nil, fmt.Errorf("resource preset %q: %w", name, err)
+		}
+	}
+	if _, err := policy.resolve(nil); err != nil {
+		return nil, fmt.Errorf("default resources: %w", err)
+	}
+
+	return policy, nil
+}
+
+// resolve applies the requested preset and overrides on top of the defaults
+// and validates the result against the ceiling.
+func (p *resourcePolicy) resolve(requested *GameResources) (*resolvedResources, error) {
+	profile := defaultResourceProfile()
+	if preset, ok := p.presets[defaultPresetName]; ok {
+		profile = profile.merge(preset)
+	}
+
+	if requested != nil {
+		if requested.Preset != "" && requested.Preset != defaultPresetName {
+			preset, ok := p.presets[requested.Preset]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown preset %q", ErrInvalidResources, requested.Preset)
+			}
+			profile = profile.merge(preset)
+		}
+		profile = profile.merge(requested.ResourceProfile)
+	}
+
+	var (
+		resolved resolvedResources
+		err      error
+	)
+	if resolved.clone, err = profile.Clone.requirements("clone", p.ceiling.Clone); err != nil {
+		return nil, err
+	}
+	if resolved.bot, err = profile.Bot.requirements("bot", p.ceiling.Bot); err != nil {
+		return nil, err
+	}
+	if resolved.game, err = profile.Game.requirements("game", p.ceiling.Game); err != nil {
+		return nil, err
+	}
+	if resolved.netGuard, err = profile.NetGuard.requirements("netGuard", p.ceiling.NetGuard); err != nil {
+		return nil, err
+	}
+
+	resolved.storage, err = resource.ParseQuantity(profile.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("%w: storage: %w", ErrInvalidResources, err)
+	}
+	if resolved.storage.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: storage must be positive, got %s", ErrInvalidResources, resolved.storage.String())
+	}
+	if err := checkCeiling("storage", resolved.storage, p.ceiling.Storage); err != nil {
+		return nil, err
+	}
+
+	resolved.deadlineSeconds = profile.DeadlineSeconds
+	if resolved.deadlineSeconds <= 0 || resolved.deadlineSeconds > p.ceiling.DeadlineSeconds {
+		return nil, fmt.Errorf("%w: deadlineSeconds must be between 1 and %d, got %d",
+			ErrInvalidResources, p.ceiling.DeadlineSeconds, resolved.deadlineSeconds)
+	}
+
+	return &resolved, nil
+}
+
+// requirements converts r into Kubernetes resource requirements, making sure
+// every request fits its limit and every limit fits the ceiling.
+func (r *ContainerResources) requirements(name string, ceiling *ContainerResources) (corev1.ResourceRequirements, error) {
+	if ceiling == nil {
+		ceiling = &ContainerResources{}
+	}
+
+	quantities := []struct {
+		field, request, limit, ceiling string
+		resource                       corev1.ResourceName
+	}{
+		{field: "cpu", request: r.CPURequest, limit: r.CPULimit, ceiling: ceiling.CPULimit, resource: corev1.ResourceCPU},
+		{field: "memory", request: r.MemoryRequest, limit: r.MemoryLimit, ceiling: ceiling.MemoryLimit, resource: corev1.ResourceMemory},
+	}
+
+	requirements := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+	for _, q := range quantities {
+		field := name + "." + q.field
+		request, err := resource.ParseQuantity(q.request)
+		if err != nil {
+			return requirements, fmt.Errorf("%w: %s request: %w", ErrInvalidResources, field, err)
+		}
+		limit, err := resource.ParseQuantity(q.limit)
+		if err != nil {
+			return requirements, fmt.Errorf("%w: %s limit: %w", ErrInvalidResources, field, err)
+		}
+		if request.Sign() <= 0 || request.Cmp(limit) > 0 {
+			return requirements, fmt.Errorf("%w: %s request %s must be positive and not exceed the limit %s",
+				ErrInvalidResources, field, request.String(), limit.String())
+		}
+		if err := checkCeiling(field+" limit", limit, q.ceiling); err != nil {
+			return requirements, err
+		}
+
+		requirements.Requests[q.resource] = request
+		requirements.Limits[q.resource] = limit
+	}
+	return requirements, nil
+}
+
+func checkCeiling(field string, value resource.Quantity, ceiling string) error {
+	if ceiling == "" {
+		return nil
+	}
+	max, err := resource.ParseQuantity(ceiling)
+	if err != nil {
+		return fmt.Errorf("invalid ceiling for %s: %w", field, err)
+	}
+	if value.Cmp(max) > 0 {
+		return fmt.Errorf("%w: %s %s exceeds the ceiling of %s", ErrInvalidResources, field, value.String(), max.String())
+	}
+	return nil
+}
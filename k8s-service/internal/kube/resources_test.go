@@ -0,0 +1,125 @@
+package kube_test
+
+import (
+	"context"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Resources", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		game      kube.Game
+	)
+
+	BeforeEach(func() {
+		presets := *cfg
+		presets.ResourcePresets = `{"tight": {"bot": {"cpuLimit": "500m", "memoryLimit": "256Mi"}, "deadlineSeconds": 600}}`
+		presets.ResourceCeiling = `{"bot": {"cpuLimit": "2", "memoryLimit": "2Gi"}, "deadlineSeconds": 3600}`
+		client, clientset = newFakeClientWithConfig(&presets)
+		game = newGame()
+	})
+
+	containerResources := func(name string) corev1.ResourceRequirements {
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for _, container := range job.Spec.Template.Spec.Containers {
+			if container.Name == name {
+				return container.Resources
+			}
+		}
+		Fail("no container " + name)
+		return corev1.ResourceRequirements{}
+	}
+
+	It("should use the built-in profile without resources", func() {
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		bot := containerResources("bot-" + game.Bots[0].ID.String())
+		Expect(bot.Limits.Cpu().String()).To(Equal("1"))
+		Expect(bot.Requests.Memory().String()).To(Equal("256Mi"))
+	})
+
+	It("should merge a partial override into the selected preset", func() {
+		game.Resources = &kube.GameResources{
+			Preset: "tight",
+			ResourceProfile: kube.ResourceProfile{
+				Bot:  &kube.ContainerResources{MemoryLimit: "384Mi"},
+				Game: &kube.ContainerResources{CPULimit: "3"},
+			},
+		}
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+
+		bot := containerResources("bot-" + game.Bots[0].ID.String())
+		// The CPU limit comes from the preset, the memory limit from the
+		// override and the requests from the built-in profile.
+		Expect(bot.Limits.Cpu().String()).To(Equal("500m"))
+		Expect(bot.Limits.Memory().String()).To(Equal("384Mi"))
+		Expect(bot.Requests.Cpu().String()).To(Equal("250m"))
+
+		server := containerResources("game")
+		Expect(server.Limits.Cpu().String()).To(Equal("3"))
+		Expect(server.Limits.Memory().String()).To(Equal("1Gi"))
+	})
+
+	DescribeTable("should reject invalid resources",
+		func(resources kube.GameResources) {
+			game.Resources = &resources
+			Expect(client.CreateGameJob(&game)).To(MatchError(kube.ErrInvalidResources))
+		},
+		Entry("unknown preset", kube.GameResources{Preset: "huge"}),
+		Entry("limit above the ceiling", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Bot: &kube.ContainerResources{CPULimit: "3"},
+		}}),
+		Entry("storage above the ceiling", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Storage: "2Gi",
+		}}),
+		Entry("deadline above the ceiling", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			DeadlineSeconds: 7200,
+		}}),
+		Entry("request above the limit", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Bot: &kube.ContainerResources{CPURequest: "750m", CPULimit: "500m"},
+		}}),
+		Entry("invalid quantity", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Bot: &kube.ContainerResources{MemoryLimit: "lots"},
+		}}),
+		Entry("invalid storage", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Storage: "plenty",
+		}}),
+		Entry("zero storage", kube.GameResources{ResourceProfile: kube.ResourceProfile{
+			Storage: "0",
+		}}),
+	)
+
+	DescribeTable("should reject invalid configurations",
+		func(presets, ceiling string) {
+			invalid := *cfg
+			invalid.ResourcePresets = presets
+			invalid.ResourceCeiling = ceiling
+			_, err := kube.NewClient(fake.NewSimpleClientset(), nil, &invalid, logger)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("malformed presets", `{"tight":`, ""),
+		Entry("preset above the ceiling", `{"big": {"game": {"memoryLimit": "8Gi"}}}`, ""),
+		Entry("defaults above the ceiling", "", `{"bot": {"cpuLimit": "500m"}}`),
+		Entry("invalid ceiling", "", `{"bot": {"cpuLimit": "x"}}`),
+	)
+
+	It("should apply the configured default preset to every game", func() {
+		defaults := *cfg
+		defaults.ResourcePresets = `{"default": {"storage": "500Mi"}}`
+		client, clientset = newFakeClientWithConfig(&defaults)
+
+		Expect(client.CreateGameJob(&game)).To(Succeed())
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "game-"+game.ID.String(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*job.Spec.Template.Spec.Volumes[0].EmptyDir.SizeLimit).To(Equal(resource.MustParse("500Mi")))
+	})
+})
@@ -0,0 +1,80 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PatternGameFailed is published to game_results when a game ended without the
+// game server reporting a result.
+const PatternGameFailed = "game_failed"
+
+// PatternGameCancelled is published to game_results when a running game was cancelled.
+const PatternGameCancelled = "game_cancelled"
+
+// PatternReplayStored is published to game_results when a finished game's
+// replay has been verified.
+const PatternReplayStored = "replay_stored"
+
+// PatternReplayMissing is published to game_results when a game succeeded
+// without uploading a usable replay.
+const PatternReplayMissing = "replay_missing"
+
+// Reasons a replay is reported as missing.
+const (
+	ReplayMissingNotUploaded = "not_uploaded"
+	ReplayMissingEmpty       = "empty"
+)
+
+// Outcomes of a game Job. Only failed outcomes are published as end reasons.
+const (
+	EndReasonSucceeded = "succeeded"
+	EndReasonFailed    = "failed"
+	EndReasonTimeout   = "timeout"
+	EndReasonCancelled = "cancelled"
+)
+
+// ResultPublisher publishes NestJS-style messages to the game_results queue.
+type ResultPublisher interface {
+	PublishResult(ctx context.Context, pattern string, data any) error
+}
+
+// GameFailure is the payload of PatternGameFailed and PatternGameCancelled messages.
+type GameFailure struct {
+	GameID    uuid.UUID `json:"game_id"`
+	EndReason string    `json:"end_reason"`
+	Message   string    `json:"message,omitempty"`
+	// Container is the name of the container that caused the failure, if known.
+	Container string `json:"container,omitempty"`
+	// ContainerReason is the waiting or termination reason reported by the kubelet,
+	// e.g. "Error", "OOMKilled" or "ImagePullBackOff".
+	ContainerReason string `json:"container_reason,omitempty"`
+	ExitCode        *int32 `json:"exit_code,omitempty"`
+	// BotCommits maps bot IDs to the commit SHA they were built from.
+	BotCommits map[string]string `json:"bot_commits,omitempty"`
+	FinishedAt time.Time         `json:"finished_at"`
+}
+
+// ReplayResult is the payload of PatternReplayStored and PatternReplayMissing messages.
+type ReplayResult struct {
+	GameID uuid.UUID `json:"game_id"`
+	// Key is the object key of the replay in the bucket.
+	Key string `json:"key,omitempty"`
+	// Format is the encoding of the replay: json, gzip or zstd.
+	Format string `json:"format,omitempty"`
+	Size   int64  `json:"size"`
+	// ETag is the checksum reported by the object storage.
+	ETag       string     `json:"etag,omitempty"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
+	// Reason explains why the replay is missing.
+	Reason string `json:"reason,omitempty"`
+	// BotCommits maps bot IDs to the commit SHA they were built from.
+	BotCommits map[string]string `json:"bot_commits,omitempty"`
+}
+
+// SetResultPublisher configures where the client reports game outcomes to.
+func (c *Client) SetResultPublisher(publisher ResultPublisher) {
+	c.results = publisher
+}
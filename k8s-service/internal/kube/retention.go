@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// retentionClass returns the retention class the game's replay and logs are stored with.
+func (c *Client) retentionClass(game *Game) string {
+	if game.RetentionClass != "" {
+		return game.RetentionClass
+	}
+	return c.retention.DefaultClass()
+}
+
+// tagReplayRetention tags the replay of a finished game, if it was uploaded,
+// with the retention class stored on its Job.
+func (c *Client) tagReplayRetention(ctx context.Context, gameID uuid.UUID, job *batchv1.Job) error {
+	replay, err := c.s3Client.StatReplay(ctx, gameID)
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up replay: %w", err)
+	}
+
+	retentionClass := job.Annotations[annotationRetentionClass]
+	if retentionClass == "" {
+		retentionClass = c.retention.DefaultClass()
+	}
+	return c.s3Client.TagReplayRetention(ctx, replay, retentionClass)
+}
+
+// RunRetentionSweeper deletes replays and logs past the retention of their
+// class every interval until ctx is cancelled. With RETENTION_DRY_RUN set it
+// only logs what would be deleted.
+func (c *Client) RunRetentionSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		c.logger.Infoln("Retention sweeper disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := c.s3Client.SweepExpired(ctx, c.retention, time.Now(), c.cfg.RetentionDryRun)
+		if err != nil {
+			c.logger.Errorw("Retention sweep failed", "error", err)
+		} else if report.DryRun {
+			c.logger.Infow("Retention sweep (dry run)", "expiredObjects", len(report.Objects), "totalSize", report.TotalSize)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RetentionReport lists the objects the next sweep would delete without deleting anything.
+func (c *Client) RetentionReport(ctx context.Context) (*s3.RetentionReport, error) {
+	return c.s3Client.SweepExpired(ctx, c.retention, time.Now(), true)
+}
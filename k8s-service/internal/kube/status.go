@@ -0,0 +1,213 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MatchPhase is the coarse state of a match.
+type MatchPhase string
+
+const (
+	MatchPhasePending       MatchPhase = "pending"
+	MatchPhasePullingImages MatchPhase = "pulling_images"
+	MatchPhaseCloning       MatchPhase = "cloning"
+	MatchPhaseRunning       MatchPhase = "running"
+	MatchPhaseSucceeded     MatchPhase = "succeeded"
+	MatchPhaseFailed        MatchPhase = "failed"
+	MatchPhaseTimedOut      MatchPhase = "timed_out"
+)
+
+// Container states reported in a ContainerState.
+const (
+	ContainerStateWaiting    = "waiting"
+	ContainerStateRunning    = "running"
+	ContainerStateTerminated = "terminated"
+	ContainerStateUnknown    = "unknown"
+)
+
+// waitingForImageReasons are kubelet waiting reasons while an image is pulled.
+var waitingForImageReasons = map[string]bool{
+	"ContainerCreating": true,
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+}
+
+// ContainerState is the state of a single container of a match.
+type ContainerState struct {
+	Name         string
+	Init         bool
+	State        string
+	Reason       string
+	Message      string
+	ExitCode     *int32
+	RestartCount int32
+	StartedAt    *time.Time
+	FinishedAt   *time.Time
+}
+
+// MatchStatus is the state of a match built from its Job and pod.
+type MatchStatus struct {
+	GameID         uuid.UUID
+	Phase          MatchPhase
+	Message        string
+	StartTime      *time.Time
+	CompletionTime *time.Time
+	BotCommits     map[string]string
+	// BotIDMapping maps the RndIDs the game server knows the bots by to their bot IDs.
+	BotIDMapping map[string]string
+	Containers   []ContainerState
+}
+
+// GetMatchStatus returns the status of the game's Job, or ErrMatchNotFound.
+func (c *Client) GetMatchStatus(ctx context.Context, gameID uuid.UUID) (*MatchStatus, error) {
+	job, err := c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, gameJobPrefix+gameID.String(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrMatchNotFound, gameID.String())
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	pod, err := c.gamePod(ctx, job.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MatchStatus{
+		GameID:         gameID,
+		Phase:          matchPhase(job, pod),
+		Message:        jobFailureMessage(job),
+		StartTime:      timePtr(job.Status.StartTime),
+		CompletionTime: timePtr(job.Status.CompletionTime),
+		BotCommits:     botCommits(pod),
+		Containers:     containerStates(pod),
+	}
+
+	// The pod may already be gone, fall back to what was recorded on the Job.
+	if len(status.BotCommits) == 0 {
+		if recorded, ok := job.Annotations[annotationBotCommits]; ok {
+			if err := json.Unmarshal([]byte(recorded), &status.BotCommits); err != nil {
+				c.logger.Warnw("Invalid bot commits annotation", "jobName", job.Name, "error", err)
+			}
+		}
+	}
+	if mapping, ok := job.Annotations[annotationBotIDMapping]; ok {
+		if err := json.Unmarshal([]byte(mapping), &status.BotIDMapping); err != nil {
+			c.logger.Warnw("Invalid bot ID mapping annotation", "jobName", job.Name, "error", err)
+		}
+	}
+	if status.CompletionTime == nil {
+		if _, finished := jobOutcome(job); finished {
+			finishedAt := jobFinishedAt(job)
+			status.CompletionTime = &finishedAt
+		}
+	}
+
+	return status, nil
+}
+
+func matchPhase(job *batchv1.Job, pod *corev1.Pod) MatchPhase {
+	if outcome, finished := jobOutcome(job); finished {
+		switch outcome {
+		case EndReasonSucceeded:
+			return MatchPhaseSucceeded
+		case EndReasonTimeout:
+			return MatchPhaseTimedOut
+		default:
+			return MatchPhaseFailed
+		}
+	}
+	if pod == nil {
+		return MatchPhasePending
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+		return MatchPhaseRunning
+	case corev1.PodSucceeded:
+		return MatchPhaseSucceeded
+	case corev1.PodFailed:
+		return MatchPhaseFailed
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Running != nil && strings.HasPrefix(status.Name, cloneContainerPrefix) {
+			return MatchPhaseCloning
+		}
+	}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if w := status.State.Waiting; w != nil && waitingForImageReasons[w.Reason] {
+			return MatchPhasePullingImages
+		}
+	}
+	return MatchPhasePending
+}
+
+func containerStates(pod *corev1.Pod) []ContainerState {
+	states := []ContainerState{}
+	if pod == nil {
+		return states
+	}
+
+	statuses := map[string]corev1.ContainerStatus{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		statuses[status.Name] = status
+	}
+
+	add := func(container corev1.Container, init bool) {
+		state := ContainerState{
+			Name:  container.Name,
+			Init:  init,
+			State: ContainerStateUnknown,
+		}
+
+		if status, ok := statuses[container.Name]; ok {
+			state.RestartCount = status.RestartCount
+			switch {
+			case status.State.Waiting != nil:
+				state.State = ContainerStateWaiting
+				state.Reason = status.State.Waiting.Reason
+				state.Message = status.State.Waiting.Message
+			case status.State.Running != nil:
+				state.State = ContainerStateRunning
+				state.StartedAt = timePtr(&status.State.Running.StartedAt)
+			case status.State.Terminated != nil:
+				t := status.State.Terminated
+				exitCode := t.ExitCode
+				state.State = ContainerStateTerminated
+				state.Reason = t.Reason
+				state.Message = t.Message
+				state.ExitCode = &exitCode
+				state.StartedAt = timePtr(&t.StartedAt)
+				state.FinishedAt = timePtr(&t.FinishedAt)
+			}
+		}
+		states = append(states, state)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		add(container, true)
+	}
+	for _, container := range pod.Spec.Containers {
+		add(container, false)
+	}
+	return states
+}
+
+func timePtr(t *metav1.Time) *time.Time {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return &t.Time
+}
@@ -8,14 +8,39 @@ type GameMessage struct {
 }
 
 type Game struct {
-	ID    uuid.UUID `json:"id"`
-	Bots  []Bot     `json:"bots"`
-	Image string    `json:"image"`
+	ID        uuid.UUID      `json:"id"`
+	Bots      []Bot          `json:"bots"`
+	Image     string         `json:"image"`
+	Resources *GameResources `json:"resources,omitempty"`
+	// Type selects how the bots are built and run. The "default" game type is
+	// used if it is empty.
+	Type string `json:"type,omitempty"`
+	// ReplayFormat is the encoding the game server uploads the replay in:
+	// "json", "gzip" or "zstd". REPLAY_FORMAT is used if it is empty.
+	ReplayFormat string `json:"replayFormat,omitempty"`
+	// RetentionClass selects how long the replay and logs are kept, e.g.
+	// "final" or "queue". RETENTION_DEFAULT_CLASS is used if it is empty.
+	RetentionClass string `json:"retentionClass,omitempty"`
+	// Priority is "casual" or "tournament". It defaults to the lane the
+	// message was consumed from and selects the pod's PriorityClass.
+	Priority string `json:"priority,omitempty"`
+}
+
+func (g *Game) gameType() string {
+	if g.Type == "" {
+		return defaultGameTypeName
+	}
+	return g.Type
 }
 
 type Bot struct {
 	ID      uuid.UUID `json:"id"`
 	RndID   *string   `json:"rndID"`
 	RepoURL string    `json:"repoURL"`
-	Image   string    `json:"image"`
+	// Ref is the branch, tag or commit SHA to check out. The default branch is
+	// used if it is empty.
+	Ref   string `json:"ref,omitempty"`
+	Image string `json:"image"`
+	// Credentials are used to clone private repositories.
+	Credentials *BotCredentials `json:"credentials,omitempty"`
 }
@@ -0,0 +1,250 @@
+package kube
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Defaults used when the corresponding configuration is not set.
+const (
+	defaultMinBots = 2
+	defaultMaxBots = 4
+)
+
+var (
+	defaultRepoURLSchemes = []string{"https", "ssh"}
+	defaultRepoHosts      = []string{"github.com"}
+)
+
+// shellMetacharacters may never appear in values passed on to containers.
+const shellMetacharacters = "`$;&|<>(){}[]\\\"' \t\r\n*?!~#"
+
+var (
+	refPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	// hexRef matches refs that look like a commit SHA. The bot is cloned with
+	// git fetch --depth 1, which only accepts full SHAs.
+	hexRef = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	// scpLikeURL matches the scp-like syntax git accepts for SSH, e.g.
+	// git@github.com:org/repo.git.
+	scpLikeURL = regexp.MustCompile(`^([A-Za-z0-9._-]+@)?([A-Za-z0-9.-]+):([^/][^:]*)$`)
+)
+
+// FieldError is a single problem found in a game message.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a game message. It matches
+// ErrInvalidGame with errors.Is.
+type ValidationError struct {
+	Problems []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.Field + ": " + p.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidGame, strings.Join(problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidGame
+}
+
+// Fields returns the names of the invalid fields.
+func (e *ValidationError) Fields() []string {
+	fields := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		fields[i] = p.Field
+	}
+	return fields
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Problems = append(e.Problems, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// gameValidator checks game messages before anything is scheduled for them.
+type gameValidator struct {
+	minBots         int
+	maxBots         int
+	repoURLSchemes  []string
+	repoHosts       []string
+	imageRegistries []string
+	gameTypes       map[string]GameType
+}
+
+func newGameValidator(cfg *config.Config, gameTypes map[string]GameType) (*gameValidator, error) {
+	v := &gameValidator{
+		minBots:         cfg.GameMinBots,
+		maxBots:         cfg.GameMaxBots,
+		repoURLSchemes:  cfg.RepoURLSchemes,
+		repoHosts:       cfg.RepoHosts,
+		imageRegistries: cfg.ImageRegistries,
+		gameTypes:       gameTypes,
+	}
+	if v.minBots == 0 {
+		v.minBots = defaultMinBots
+	}
+	if v.maxBots == 0 {
+		v.maxBots = defaultMaxBots
+	}
+	if len(v.repoURLSchemes) == 0 {
+		v.repoURLSchemes = defaultRepoURLSchemes
+	}
+	if len(v.repoHosts) == 0 {
+		v.repoHosts = defaultRepoHosts
+	}
+
+	if v.minBots < 1 || v.maxBots < v.minBots {
+		return nil, fmt.Errorf("invalid bot count bounds: min %d, max %d", v.minBots, v.maxBots)
+	}
+	return v, nil
+}
+
+// validate returns a *ValidationError describing every problem of the game, or nil.
+func (v *gameValidator) validate(game *Game) error {
+	verr := &ValidationError{}
+
+	if game.ID == uuid.Nil {
+		verr.add("id", "must be set")
+	}
+	v.validateImage(verr, "image", game.Image)
+	if _, ok := v.gameTypes[game.gameType()]; !ok {
+		verr.add("type", "unknown game type %q", game.Type)
+	}
+	if game.RetentionClass != "" {
+		if errs := validation.IsDNS1123Label(game.RetentionClass); len(errs) > 0 {
+			verr.add("retentionClass", "%s", strings.Join(errs, ", "))
+		}
+	}
+	if !slices.Contains(priorities, game.priority()) {
+		verr.add("priority", "must be one of %s", strings.Join(priorities, ", "))
+	}
+	if game.ReplayFormat != "" {
+		if _, err := s3.ParseReplayFormat(game.ReplayFormat); err != nil {
+			verr.add("replayFormat", "must be one of json, gzip or zstd")
+		}
+	}
+
+	if n := len(game.Bots); n < v.minBots || n > v.maxBots {
+		verr.add("bots", "must contain between %d and %d bots, got %d", v.minBots, v.maxBots, n)
+	}
+
+	seen := make(map[uuid.UUID]bool, len(game.Bots))
+	for i, bot := range game.Bots {
+		field := fmt.Sprintf("bots[%d]", i)
+
+		if bot.ID == uuid.Nil {
+			verr.add(field+".id", "must be set")
+		} else if seen[bot.ID] {
+			verr.add(field+".id", "duplicate bot ID %s", bot.ID)
+		}
+		seen[bot.ID] = true
+
+		v.validateImage(verr, field+".image", bot.Image)
+		v.validateRepoURL(verr, field+".repoURL", bot.RepoURL)
+		if bot.Ref != "" {
+			validateRef(verr, field+".ref", bot.Ref)
+		}
+		if bot.Credentials != nil {
+			if err := bot.Credentials.validate(); err != nil {
+				verr.add(field+".credentials", "%s", err)
+			}
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (v *gameValidator) validateRepoURL(verr *ValidationError, field, repoURL string) {
+	if repoURL == "" {
+		verr.add(field, "must be set")
+		return
+	}
+	if strings.ContainsAny(repoURL, shellMetacharacters) || strings.HasPrefix(repoURL, "-") {
+		verr.add(field, "contains forbidden characters")
+		return
+	}
+
+	// Never echo the URL itself, it may carry an access token.
+	u, err := parseRepoURL(repoURL)
+	if err != nil {
+		verr.add(field, "is not a valid URL")
+		return
+	}
+	if !slices.Contains(v.repoURLSchemes, u.Scheme) {
+		verr.add(field, "scheme %q is not allowed", u.Scheme)
+	}
+	if !slices.Contains(v.repoHosts, u.Hostname()) {
+		verr.add(field, "host %q is not allowed", u.Hostname())
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		verr.add(field, "must contain a repository path")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		verr.add(field, "must not contain a query or fragment")
+	}
+}
+
+// parseRepoURL parses a repository URL, translating the scp-like SSH syntax
+// into an ssh:// URL.
+func parseRepoURL(repoURL string) (*url.URL, error) {
+	if !strings.Contains(repoURL, "://") {
+		if m := scpLikeURL.FindStringSubmatch(repoURL); m != nil {
+			return url.Parse("ssh://" + m[1] + m[2] + "/" + m[3])
+		}
+	}
+	return url.Parse(repoURL)
+}
+
+func (v *gameValidator) validateImage(verr *ValidationError, field, image string) {
+	if image == "" {
+		verr.add(field, "must be set")
+		return
+	}
+	if strings.ContainsAny(image, shellMetacharacters) || strings.HasPrefix(image, "-") {
+		verr.add(field, "contains forbidden characters")
+		return
+	}
+	if len(v.imageRegistries) > 0 {
+		if registry := imageRegistry(image); !slices.Contains(v.imageRegistries, registry) {
+			verr.add(field, "registry %q is not allowed", registry)
+		}
+	}
+}
+
+func validateRef(verr *ValidationError, field, ref string) {
+	if len(ref) > 255 || !refPattern.MatchString(ref) ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "//") ||
+		strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".lock") {
+		verr.add(field, "%q is not a valid branch, tag or commit", ref)
+		return
+	}
+	if hexRef.MatchString(ref) && len(ref) != 40 {
+		verr.add(field, "%q looks like an abbreviated commit, use the full 40-character SHA", ref)
+	}
+}
+
+// imageRegistry returns the registry host of an image reference, following
+// the Docker convention that references without one are pulled from Docker Hub.
+func imageRegistry(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "docker.io"
+}
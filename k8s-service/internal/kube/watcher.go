@@ -0,0 +1,360 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const jobResyncPeriod = 5 * time.Minute
+
+// WatchGameJobs starts an informer on the game Jobs of the namespace and
+// handles every Job once it has finished. It returns after the initial sync.
+func (c *Client) WatchGameJobs(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, jobResyncPeriod,
+		informers.WithNamespace(c.namespace))
+	informer := factory.Batch().V1().Jobs().Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			c.onGameJobChanged(obj)
+		},
+		UpdateFunc: func(_, obj any) {
+			c.onGameJobChanged(obj)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register job event handler: %w", err)
+	}
+	_, err = informer.AddEventHandler(c.capacity.eventHandler())
+	if err != nil {
+		return fmt.Errorf("failed to register capacity event handler: %w", err)
+	}
+
+	// Image pull failures are counted from the game pods while they wait,
+	// the Job only fails once its deadline has passed.
+	podInformer := factory.Core().V1().Pods().Informer()
+	_, err = podInformer.AddEventHandler(c.imagePulls.eventHandler())
+	if err != nil {
+		return fmt.Errorf("failed to register image pull event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced, podInformer.HasSynced) {
+		return fmt.Errorf("failed to sync game informers")
+	}
+	c.capacity.markSynced()
+
+	c.logger.Infoln("Watching game jobs", "namespace", c.namespace)
+	return nil
+}
+
+func (c *Client) onGameJobChanged(obj any) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok || !strings.HasPrefix(job.Name, gameJobPrefix) {
+		return
+	}
+	if job.Annotations[annotationFinalized] == "true" || job.DeletionTimestamp != nil {
+		return
+	}
+	if _, finished := jobOutcome(job); !finished {
+		return
+	}
+
+	// Finalizing talks to the Kubernetes API and RabbitMQ, keep it out of the
+	// informer's event loop and make sure a Job is only handled once at a time.
+	if _, busy := c.finalizing.LoadOrStore(job.Name, struct{}{}); busy {
+		return
+	}
+	// Jobs finishing during a shutdown are left to the other replicas.
+	c.finalizeMu.Lock()
+	if c.draining {
+		c.finalizeMu.Unlock()
+		c.finalizing.Delete(job.Name)
+		return
+	}
+	c.finalizers.Add(1)
+	c.finalizeMu.Unlock()
+	go func() {
+		defer c.finalizers.Done()
+		defer c.finalizing.Delete(job.Name)
+
+		if err := c.finalizeGameJob(c.finalizeCtx, job); err != nil {
+			c.logger.Errorw("Failed to finalize game job", "jobName", job.Name, "error", err)
+		}
+	}()
+}
+
+// DrainFinalization waits for the finalizations in flight, which keep running
+// after the watch has stopped. Once ctx is done they are interrupted; their
+// Jobs are not marked as finalized and are picked up again by the next watch.
+func (c *Client) DrainFinalization(ctx context.Context) error {
+	c.finalizeMu.Lock()
+	c.draining = true
+	c.finalizeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.finalizers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.stopFinalizing()
+		return ctx.Err()
+	}
+}
+
+// finalizeGameJob reports the outcome of a finished Job and marks it as finalized.
+func (c *Client) finalizeGameJob(ctx context.Context, job *batchv1.Job) error {
+	outcome, _ := jobOutcome(job)
+
+	gameID, err := uuid.Parse(strings.TrimPrefix(job.Name, gameJobPrefix))
+	if err != nil {
+		return fmt.Errorf("job name does not contain a game ID: %w", err)
+	}
+
+	pod, err := c.gamePod(ctx, job.Name)
+	if err != nil {
+		c.logger.Warnw("Could not get pod of finished game job", "jobName", job.Name, "error", err)
+	}
+	commits := botCommits(pod)
+
+	if pod != nil {
+		if err := c.persistLogs(ctx, gameID, pod); err != nil {
+			return err
+		}
+	}
+	if err := c.tagReplayRetention(ctx, gameID, job); err != nil {
+		return err
+	}
+
+	// The game server publishes the result itself before it exits. A bot
+	// failing afterwards, or the deadline hitting the remaining bots, fails
+	// the Job but not the game.
+	if outcome != EndReasonSucceeded && c.gameCompleted(ctx, gameID, pod) {
+		c.logger.Infow("Game job failed after the game server finished, treating it as succeeded",
+			"gameID", gameID, "endReason", outcome)
+		outcome = EndReasonSucceeded
+	}
+
+	var failure *GameFailure
+	if outcome != EndReasonSucceeded {
+		failure = &GameFailure{
+			GameID:     gameID,
+			EndReason:  outcome,
+			Message:    jobFailureMessage(job),
+			BotCommits: commits,
+			FinishedAt: jobFinishedAt(job),
+		}
+		describeFailedContainer(pod, failure)
+
+		if c.results == nil {
+			return fmt.Errorf("no result publisher configured")
+		}
+		if err := c.results.PublishResult(ctx, PatternGameFailed, failure); err != nil {
+			return fmt.Errorf("failed to publish game failure: %w", err)
+		}
+		c.logger.Infow("Published game failure", "gameID", gameID, "endReason", outcome,
+			"container", failure.Container, "exitCode", failure.ExitCode)
+	} else if err := c.verifyReplay(ctx, gameID, commits); err != nil {
+		return err
+	}
+
+	commitsJSON, err := json.Marshal(commits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bot commits: %w", err)
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				annotationFinalized:  "true",
+				annotationBotCommits: string(commitsJSON),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal job patch: %w", err)
+	}
+
+	_, err = c.clientset.BatchV1().Jobs(c.namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to mark job as finalized: %w", err)
+	}
+	observeMatchOutcome(outcome)
+	return nil
+}
+
+// gameCompleted reports whether the game server finished the game. It exits
+// successfully once it has published the result; if the pod is gone, an
+// uploaded replay is taken as proof instead.
+func (c *Client) gameCompleted(ctx context.Context, gameID uuid.UUID, pod *corev1.Pod) bool {
+	if pod != nil {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == gameContainerName {
+				t := status.State.Terminated
+				return t != nil && t.ExitCode == 0
+			}
+		}
+		return false
+	}
+
+	info, err := c.s3Client.StatReplay(ctx, gameID)
+	return err == nil && info.Size > 0
+}
+
+// verifyReplay checks that the game server uploaded a non-empty replay and
+// publishes its metadata, or that it is missing, to game_results, along with
+// the commits the bots were built from.
+func (c *Client) verifyReplay(ctx context.Context, gameID uuid.UUID, commits map[string]string) error {
+	if c.results == nil {
+		return fmt.Errorf("no result publisher configured")
+	}
+
+	result := ReplayResult{GameID: gameID, BotCommits: commits}
+	pattern := PatternReplayStored
+
+	info, err := c.s3Client.StatReplay(ctx, gameID)
+	switch {
+	case errors.Is(err, s3.ErrNotFound):
+		pattern = PatternReplayMissing
+		result.Reason = ReplayMissingNotUploaded
+	case err != nil:
+		return fmt.Errorf("failed to verify replay: %w", err)
+	default:
+		result.Key = info.Key
+		result.Format = string(info.Format)
+		result.Size = info.Size
+		result.ETag = info.ETag
+		result.UploadedAt = &info.UploadedAt
+		if info.Size == 0 {
+			pattern = PatternReplayMissing
+			result.Reason = ReplayMissingEmpty
+		}
+	}
+
+	if err := c.results.PublishResult(ctx, pattern, result); err != nil {
+		return fmt.Errorf("failed to publish replay result: %w", err)
+	}
+	if pattern == PatternReplayMissing {
+		c.logger.Warnw("Game finished without a replay", "gameID", gameID, "reason", result.Reason)
+	} else {
+		c.logger.Infow("Verified replay", "gameID", gameID, "size", result.Size, "etag", result.ETag)
+	}
+	return nil
+}
+
+// gamePod returns the pod of a game Job, or nil if it no longer exists.
+func (c *Client) gamePod(ctx context.Context, jobName string) (*corev1.Pod, error) {
+	pods, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + jobName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+	return &pods.Items[0], nil
+}
+
+// botCommits returns the commit SHA each bot was built from, as reported by
+// the termination message of its clone init container.
+func botCommits(pod *corev1.Pod) map[string]string {
+	commits := make(map[string]string)
+	if pod == nil {
+		return commits
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		botID, ok := strings.CutPrefix(status.Name, cloneContainerPrefix)
+		if !ok {
+			continue
+		}
+		if t := status.State.Terminated; t != nil && t.ExitCode == 0 {
+			if sha := strings.TrimSpace(t.Message); sha != "" {
+				commits[botID] = sha
+			}
+		}
+	}
+	return commits
+}
+
+// jobOutcome reports whether the Job has finished and how it ended.
+func jobOutcome(job *batchv1.Job) (string, bool) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return EndReasonSucceeded, true
+		case batchv1.JobFailed:
+			if cond.Reason == batchv1.JobReasonDeadlineExceeded {
+				return EndReasonTimeout, true
+			}
+			return EndReasonFailed, true
+		}
+	}
+	return "", false
+}
+
+func jobFailureMessage(job *batchv1.Job) string {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return strings.TrimSpace(cond.Reason + ": " + cond.Message)
+		}
+	}
+	return ""
+}
+
+func jobFinishedAt(job *batchv1.Job) time.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time
+	}
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobFailed || cond.Type == batchv1.JobComplete) && cond.Status == corev1.ConditionTrue {
+			return cond.LastTransitionTime.Time
+		}
+	}
+	return time.Now()
+}
+
+// describeFailedContainer fills in the first container of the pod that
+// terminated with a non-zero exit code or got stuck waiting.
+func describeFailedContainer(pod *corev1.Pod, failure *GameFailure) {
+	if pod == nil {
+		return
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+			exitCode := t.ExitCode
+			failure.Container = status.Name
+			failure.ContainerReason = t.Reason
+			failure.ExitCode = &exitCode
+			return
+		}
+		if w := status.State.Waiting; w != nil && w.Reason != "" && w.Reason != "PodInitializing" {
+			failure.Container = status.Name
+			failure.ContainerReason = w.Reason
+			return
+		}
+	}
+}
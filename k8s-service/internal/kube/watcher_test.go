@@ -0,0 +1,328 @@
+package kube_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakePublisher records the results published to game_results. While err is
+// set, publishing fails with it.
+type fakePublisher struct {
+	mu       sync.Mutex
+	patterns []string
+	data     []any
+	err      error
+}
+
+func (p *fakePublisher) PublishResult(_ context.Context, pattern string, data any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.patterns = append(p.patterns, pattern)
+	p.data = append(p.data, data)
+	return nil
+}
+
+func (p *fakePublisher) Patterns() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string{}, p.patterns...)
+}
+
+// Result returns the payload of the first result published with pattern.
+func (p *fakePublisher) Result(pattern string) any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, published := range p.patterns {
+		if published == pattern {
+			return p.data[i]
+		}
+	}
+	return nil
+}
+
+// blockingPublisher holds every result until it is released or the
+// publishing context is done.
+type blockingPublisher struct {
+	fakePublisher
+	called  chan struct{}
+	release chan struct{}
+}
+
+func newBlockingPublisher() *blockingPublisher {
+	return &blockingPublisher{called: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (p *blockingPublisher) PublishResult(ctx context.Context, pattern string, data any) error {
+	p.called <- struct{}{}
+	select {
+	case <-p.release:
+		return p.fakePublisher.PublishResult(ctx, pattern, data)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var _ = Describe("Watcher", func() {
+	var (
+		client    *kube.Client
+		clientset *fake.Clientset
+		results   *fakePublisher
+		gameID    uuid.UUID
+	)
+
+	BeforeEach(func() {
+		client, clientset = newFakeClient()
+		results = &fakePublisher{}
+		client.SetResultPublisher(results)
+		gameID = uuid.New()
+	})
+
+	jobName := func() string {
+		return "game-" + gameID.String()
+	}
+
+	addJob := func(annotations map[string]string, conditions ...batchv1.JobCondition) {
+		Expect(clientset.Tracker().Add(&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        jobName(),
+				Namespace:   namespace,
+				Annotations: annotations,
+			},
+			Status: batchv1.JobStatus{Conditions: conditions},
+		})).To(Succeed())
+	}
+
+	addPod := func(initStatuses, statuses []corev1.ContainerStatus) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName() + "-abcde",
+				Namespace: namespace,
+				Labels:    map[string]string{"job-name": jobName()},
+			},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: initStatuses,
+				ContainerStatuses:     statuses,
+			},
+		}
+		for _, status := range initStatuses {
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: status.Name})
+		}
+		for _, status := range statuses {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: status.Name})
+		}
+		Expect(clientset.Tracker().Add(pod)).To(Succeed())
+	}
+
+	terminated := func(name string, exitCode int32, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name: name,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason},
+			},
+		}
+	}
+
+	condition := func(conditionType batchv1.JobConditionType, reason string) batchv1.JobCondition {
+		return batchv1.JobCondition{
+			Type:               conditionType,
+			Status:             corev1.ConditionTrue,
+			Reason:             reason,
+			Message:            "job finished",
+			LastTransitionTime: metav1.NewTime(time.Now()),
+		}
+	}
+
+	watch := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		Expect(client.WatchGameJobs(ctx)).To(Succeed())
+	}
+
+	finalized := func() string {
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), jobName(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return job.Annotations["coregame/finalized"]
+	}
+
+	It("should verify the replay of a succeeded game", func() {
+		addJob(nil, condition(batchv1.JobComplete, ""))
+		addPod(nil, []corev1.ContainerStatus{terminated("game", 0, "Completed")})
+		watch()
+
+		Eventually(finalized).Should(Equal("true"))
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternReplayMissing}))
+	})
+
+	It("should report the bot commits along with the replay", func() {
+		sha := "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+		clone := terminated("clone-repo-1", 0, "Completed")
+		clone.State.Terminated.Message = sha + "\n"
+		addJob(nil, condition(batchv1.JobComplete, ""))
+		addPod([]corev1.ContainerStatus{clone}, []corev1.ContainerStatus{terminated("game", 0, "Completed")})
+		watch()
+
+		Eventually(finalized).Should(Equal("true"))
+		result := results.Result(kube.PatternReplayMissing).(kube.ReplayResult)
+		Expect(result.BotCommits).To(Equal(map[string]string{"1": sha}))
+	})
+
+	It("should publish the container that made a game fail", func() {
+		addJob(nil, condition(batchv1.JobFailed, batchv1.JobReasonBackoffLimitExceeded))
+		addPod([]corev1.ContainerStatus{
+			terminated("clone-repo-1", 0, "Completed"),
+			terminated("clone-repo-2", 128, "Error"),
+		}, []corev1.ContainerStatus{
+			{Name: "game", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+		})
+		watch()
+
+		Eventually(finalized).Should(Equal("true"))
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternGameFailed}))
+		failure := results.Result(kube.PatternGameFailed).(*kube.GameFailure)
+		Expect(failure.GameID).To(Equal(gameID))
+		Expect(failure.EndReason).To(Equal(kube.EndReasonFailed))
+		Expect(failure.Message).To(Equal("BackoffLimitExceeded: job finished"))
+		Expect(failure.Container).To(Equal("clone-repo-2"))
+		Expect(failure.ContainerReason).To(Equal("Error"))
+		Expect(*failure.ExitCode).To(BeEquivalentTo(128))
+	})
+
+	It("should report a game past its deadline as timed out", func() {
+		addJob(nil, condition(batchv1.JobFailed, batchv1.JobReasonDeadlineExceeded))
+		addPod(nil, []corev1.ContainerStatus{
+			{Name: "game", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		})
+		watch()
+
+		Eventually(finalized).Should(Equal("true"))
+		failure := results.Result(kube.PatternGameFailed).(*kube.GameFailure)
+		Expect(failure.EndReason).To(Equal(kube.EndReasonTimeout))
+		Expect(failure.Container).To(BeEmpty())
+	})
+
+	It("should not fail a game the game server has finished", func() {
+		addJob(nil, condition(batchv1.JobFailed, batchv1.JobReasonBackoffLimitExceeded))
+		addPod(nil, []corev1.ContainerStatus{
+			terminated("game", 0, "Completed"),
+			terminated("bot-1", 1, "Error"),
+		})
+		watch()
+
+		Eventually(finalized).Should(Equal("true"))
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternReplayMissing}))
+	})
+
+	It("should not finalize a job before its logs are persisted", func() {
+		// A file in place of the game's directory makes the upload fail.
+		blocker := filepath.Join(cfg.LocalStoragePath, gameID.String())
+		Expect(os.WriteFile(blocker, nil, 0o600)).To(Succeed())
+		DeferCleanup(os.RemoveAll, blocker)
+
+		addJob(nil, condition(batchv1.JobComplete, ""))
+		addPod(nil, []corev1.ContainerStatus{terminated("game", 0, "Completed")})
+		watch()
+
+		Consistently(results.Patterns, 200*time.Millisecond).Should(BeEmpty())
+		Expect(finalized()).To(BeEmpty())
+
+		// The next resync retries the Job.
+		Expect(os.Remove(blocker)).To(Succeed())
+		job, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), jobName(), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		job.Labels = map[string]string{"resync": "true"}
+		_, err = clientset.BatchV1().Jobs(namespace).Update(context.Background(), job, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(finalized).Should(Equal("true"))
+		Expect(results.Patterns()).To(Equal([]string{kube.PatternReplayMissing}))
+	})
+
+	It("should not report a finalized job again", func() {
+		addJob(map[string]string{"coregame/finalized": "true"}, condition(batchv1.JobFailed, batchv1.JobReasonBackoffLimitExceeded))
+		watch()
+
+		Consistently(results.Patterns, 200*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("should ignore running jobs", func() {
+		addJob(nil)
+		watch()
+
+		Consistently(results.Patterns, 200*time.Millisecond).Should(BeEmpty())
+		Expect(finalized()).To(BeEmpty())
+	})
+
+	Describe("draining", func() {
+		var publisher *blockingPublisher
+
+		BeforeEach(func() {
+			publisher = newBlockingPublisher()
+			client.SetResultPublisher(publisher)
+			addJob(nil, condition(batchv1.JobFailed, batchv1.JobReasonDeadlineExceeded))
+		})
+
+		// watchUntilPublishing watches the game jobs until the result of the
+		// failed game is being published.
+		watchUntilPublishing := func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			Expect(client.WatchGameJobs(ctx)).To(Succeed())
+			Eventually(publisher.called).Should(Receive())
+			cancel()
+		}
+
+		It("should let finalizations finish after the watch stopped", func() {
+			watchUntilPublishing()
+
+			drained := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				drained <- client.DrainFinalization(ctx)
+			}()
+			Consistently(drained, 100*time.Millisecond).ShouldNot(Receive())
+
+			close(publisher.release)
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(publisher.Patterns()).To(Equal([]string{kube.PatternGameFailed}))
+			Expect(finalized()).To(Equal("true"))
+		})
+
+		It("should interrupt finalizations once the shutdown timeout has passed", func() {
+			watchUntilPublishing()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			Expect(client.DrainFinalization(ctx)).To(MatchError(context.DeadlineExceeded))
+
+			Consistently(finalized, 100*time.Millisecond).Should(BeEmpty())
+			Expect(publisher.Patterns()).To(BeEmpty())
+		})
+
+		It("should not start finalizations while draining", func() {
+			Expect(client.DrainFinalization(context.Background())).To(Succeed())
+			watch()
+
+			Consistently(publisher.called, 200*time.Millisecond).ShouldNot(Receive())
+			Expect(finalized()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,103 @@
+// Package metrics defines the Prometheus metrics of k8s-service. They are
+// registered with the default registry, which is served on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "k8s_service"
+
+// Pattern label of messages that could not be parsed or have no handler, so
+// arbitrary patterns do not create new series.
+const UnknownPattern = "unknown"
+
+// Actions taken on a game queue message that failed or had to wait.
+const (
+	ActionRequeued     = "requeued"
+	ActionDeadLettered = "dead_lettered"
+	// ActionDeferred is taken on games put back while no slot is free.
+	ActionDeferred = "deferred"
+)
+
+var (
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "messages_consumed_total",
+		Help:      "Game queue messages received, by queue and pattern.",
+	}, []string{"queue", "pattern"})
+
+	MessagesAcked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "messages_acked_total",
+		Help:      "Game queue messages handled successfully, by pattern.",
+	}, []string{"pattern"})
+
+	MessagesNacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "messages_nacked_total",
+		Help:      "Game queue messages that were not handled, by pattern, failure reason and whether they were requeued, dead-lettered or deferred.",
+	}, []string{"pattern", "reason", "action"})
+
+	AMQPReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "amqp_reconnects_total",
+		Help:      "Times the RabbitMQ connection was re-established after it was lost.",
+	})
+
+	CreateGameJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kube",
+		Name:      "create_game_job_duration_seconds",
+		Help:      "Time taken to create a game Job, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	CreateGameJobErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kube",
+		Name:      "create_game_job_errors_total",
+		Help:      "Game Jobs that could not be created, by cause.",
+	}, []string{"cause"})
+
+	RunningGames = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kube",
+		Name:      "running_games",
+		Help:      "Game Jobs that have not finished yet.",
+	})
+
+	MatchOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kube",
+		Name:      "match_outcomes_total",
+		Help:      "Finished matches, by outcome: succeeded, failed, timeout or cancelled.",
+	}, []string{"outcome"})
+
+	ImagePullFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kube",
+		Name:      "image_pull_failures_total",
+		Help:      "Game containers whose image could not be pulled, counted once per pod by the first kubelet reason.",
+	}, []string{"reason"})
+
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
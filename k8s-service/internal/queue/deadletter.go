@@ -0,0 +1,332 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	deadLetterExchangeName = "game_queue.dlx"
+	deadLetterQueueName    = "game_queue.dlq"
+
+	// retryQueueSuffix names the queue failed messages of a lane wait in
+	// before they are dead-lettered back to the lane.
+	retryQueueSuffix = ".retry"
+
+	// deliveryCountHeader is maintained by quorum queues and counts the
+	// previous unsuccessful delivery attempts of a message.
+	deliveryCountHeader = "x-delivery-count"
+	// retryCountHeader counts how often a message was republished to its
+	// retry queue, the broker's delivery count starts over every time.
+	retryCountHeader = "x-retry-count"
+
+	headerFailureReason    = "x-failure-reason"
+	headerFailureError     = "x-failure-error"
+	headerFailureRetryable = "x-failure-retryable"
+	headerFailedAt         = "x-failed-at"
+	headerOriginalQueue    = "x-original-queue"
+	// headerFailureFields lists the invalid fields of messages rejected by validation.
+	headerFailureFields = "x-failure-fields"
+
+	deadLetterPublishTimeout = 5 * time.Second
+)
+
+// publisher republishes failed deliveries and returns once the broker has
+// confirmed the message, so the original delivery is only acknowledged when
+// its copy is safely stored.
+type publisher interface {
+	PublishConfirmed(ctx context.Context, exchange, key string, msg amqp.Publishing) error
+}
+
+// confirmingChannel publishes on a channel in confirm mode.
+type confirmingChannel struct {
+	ch *amqp.Channel
+}
+
+func (c confirmingChannel) PublishConfirmed(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	confirm, err := c.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		return errors.New("channel is not in confirm mode")
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for broker confirmation: %w", err)
+	}
+	if !acked {
+		return errors.New("broker rejected the message")
+	}
+	return nil
+}
+
+// Failure reasons attached to dead-lettered messages.
+const (
+	ReasonParseError       = "parse_error"
+	ReasonUnknownPattern   = "unknown_pattern"
+	ReasonPresignFailed    = "s3_presign_failed"
+	ReasonKubeCreateFailed = "kubernetes_create_failed"
+	ReasonInvalidResources = "invalid_resources"
+	ReasonInvalidGame      = "invalid_game"
+	ReasonSpecMismatch     = "spec_mismatch"
+	ReasonJobTerminating   = "job_terminating"
+	ReasonProcessingFailed = "processing_failed"
+	// ReasonNoCapacity is not a failure: the game is deferred until a slot is free.
+	ReasonNoCapacity = "no_capacity"
+)
+
+// reasonShutdown labels the metrics of messages requeued on shutdown.
+const reasonShutdown = "shutdown"
+
+// deliveryError describes why a delivery could not be processed and whether
+// another attempt might succeed.
+type deliveryError struct {
+	reason    string
+	retryable bool
+	err       error
+}
+
+func (e *deliveryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+// permanentError marks err as a failure that will not go away on redelivery.
+func permanentError(reason string, err error) error {
+	return &deliveryError{reason: reason, retryable: false, err: err}
+}
+
+// classifyError maps an error returned while processing a delivery to a
+// failure reason.
+func classifyError(err error) *deliveryError {
+	var dErr *deliveryError
+	if errors.As(err, &dErr) {
+		return dErr
+	}
+
+	switch {
+	case errors.Is(err, kube.ErrInvalidResources):
+		return &deliveryError{reason: ReasonInvalidResources, retryable: false, err: err}
+	case errors.Is(err, kube.ErrInvalidGame):
+		return &deliveryError{reason: ReasonInvalidGame, retryable: false, err: err}
+	case errors.Is(err, kube.ErrSpecMismatch):
+		return &deliveryError{reason: ReasonSpecMismatch, retryable: false, err: err}
+	case errors.Is(err, kube.ErrJobTerminating):
+		return &deliveryError{reason: ReasonJobTerminating, retryable: true, err: err}
+	case errors.Is(err, kube.ErrPresignFailed):
+		return &deliveryError{reason: ReasonPresignFailed, retryable: true, err: err}
+	case errors.Is(err, kube.ErrNoCapacity):
+		return &deliveryError{reason: ReasonNoCapacity, retryable: true, err: err}
+	case errors.Is(err, kube.ErrCreateJobFailed):
+		return &deliveryError{reason: ReasonKubeCreateFailed, retryable: true, err: err}
+	default:
+		return &deliveryError{reason: ReasonProcessingFailed, retryable: true, err: err}
+	}
+}
+
+// deliveryCount returns how often the message has been delivered before,
+// counting the deliveries before every retry.
+func deliveryCount(d amqp.Delivery) int64 {
+	return intHeader(d.Headers, retryCountHeader) + intHeader(d.Headers, deliveryCountHeader)
+}
+
+func intHeader(headers amqp.Table, name string) int64 {
+	switch v := headers[name].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// retryQueue returns the queue failed messages of the lane wait in.
+func (l lane) retryQueue() string {
+	return l.queue + retryQueueSuffix
+}
+
+// declareRetryQueue declares the lane's retry queue. Messages expire after
+// their per-message TTL and are dead-lettered back to the lane.
+func declareRetryQueue(ch *amqp.Channel, l lane) error {
+	_, err := ch.QueueDeclare(
+		l.retryQueue(),
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{
+			amqp.QueueTypeArg:           amqp.QueueTypeQuorum,
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": l.queue,
+			"x-dead-letter-strategy":    "at-least-once",
+			amqp.QueueOverflowArg:       amqp.QueueOverflowRejectPublish,
+		})
+	return err
+}
+
+func (q *Queue) declareDeadLetter(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		deadLetterExchangeName,
+		amqp.ExchangeFanout,
+		true,
+		false,
+		false,
+		false,
+		nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(
+		deadLetterQueueName,
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{
+			amqp.QueueTypeArg: amqp.QueueTypeQuorum,
+		})
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(deadLetterQueueName, "", deadLetterExchangeName, false, nil)
+}
+
+// handleFailure retries a failed delivery after GAME_RETRY_DELAY while it has
+// retries left and moves it to the dead-letter queue otherwise. Games without
+// a free slot are retried without counting as an attempt. Both are
+// published on ch, the channel d was consumed from, and d is only acknowledged
+// once the broker has confirmed the copy; otherwise it is requeued.
+func (q *Queue) handleFailure(ch publisher, d amqp.Delivery, l lane, pattern string, err error) {
+	dErr := classifyError(err)
+	attempts := deliveryCount(d)
+	requeue := func() {
+		if err := d.Nack(false, true); err != nil {
+			q.logger.Errorw("Failed to requeue game message", "error", err)
+			return
+		}
+		metrics.MessagesNacked.WithLabelValues(pattern, dErr.reason, metrics.ActionRequeued).Inc()
+	}
+
+	// A game that found no free slot is put back without using up a retry,
+	// so it does not block the messages behind it.
+	if dErr.reason == ReasonNoCapacity {
+		if err := q.publishRetry(ch, d, l, intHeader(d.Headers, retryCountHeader)); err != nil {
+			q.logger.Errorw("Failed to defer game message, requeueing", "error", err, "reason", dErr.reason)
+			requeue()
+			return
+		}
+
+		q.logger.Infow("Deferring game message until a slot is free", "error", dErr.err, "retryIn", q.retryDelay)
+		if err := d.Ack(false); err != nil {
+			q.logger.Errorw("There was an error during Acknowledgement", "error", err)
+			return
+		}
+		metrics.MessagesNacked.WithLabelValues(pattern, dErr.reason, metrics.ActionDeferred).Inc()
+		return
+	}
+
+	if dErr.retryable && attempts < q.maxRetries {
+		if err := q.publishRetry(ch, d, l, attempts+1); err != nil {
+			q.logger.Errorw("Failed to delay retry of game message, requeueing", "error", err, "reason", dErr.reason)
+			requeue()
+			return
+		}
+
+		q.logger.Warnw("Retrying game message after failure",
+			"reason", dErr.reason, "error", dErr.err, "deliveryCount", attempts, "retryIn", q.retryDelay)
+		if err := d.Ack(false); err != nil {
+			q.logger.Errorw("There was an error during Acknowledgement", "error", err)
+			return
+		}
+		metrics.MessagesNacked.WithLabelValues(pattern, dErr.reason, metrics.ActionRequeued).Inc()
+		return
+	}
+
+	if err := q.publishDeadLetter(ch, d, l, dErr); err != nil {
+		q.logger.Errorw("Failed to dead-letter game message, requeueing", "error", err, "reason", dErr.reason)
+		requeue()
+		return
+	}
+
+	q.logger.Errorw("Moved game message to dead-letter queue",
+		"reason", dErr.reason, "error", dErr.err, "deliveryCount", attempts)
+	if err := d.Ack(false); err != nil {
+		q.logger.Errorw("There was an error during Acknowledgement", "error", err)
+		return
+	}
+	metrics.MessagesNacked.WithLabelValues(pattern, dErr.reason, metrics.ActionDeadLettered).Inc()
+}
+
+// publishRetry republishes the message to the lane's retry queue, from where
+// it returns to the lane once GAME_RETRY_DELAY has passed.
+func (q *Queue) publishRetry(ch publisher, d amqp.Delivery, l lane, retries int64) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	delete(headers, deliveryCountHeader)
+	headers[retryCountHeader] = retries
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterPublishTimeout)
+	defer cancel()
+
+	return ch.PublishConfirmed(ctx,
+		"",
+		l.retryQueue(),
+		amqp.Publishing{
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			Expiration:   strconv.FormatInt(q.retryDelay.Milliseconds(), 10),
+			Body:         d.Body,
+		})
+}
+
+func (q *Queue) publishDeadLetter(ch publisher, d amqp.Delivery, l lane, dErr *deliveryError) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[headerFailureReason] = dErr.reason
+	headers[headerFailureError] = dErr.err.Error()
+	headers[headerFailureRetryable] = dErr.retryable
+	headers[headerFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	headers[headerOriginalQueue] = l.queue
+	headers[deliveryCountHeader] = deliveryCount(d)
+	delete(headers, retryCountHeader)
+	var vErr *kube.ValidationError
+	if errors.As(dErr.err, &vErr) {
+		headers[headerFailureFields] = strings.Join(vErr.Fields(), ",")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterPublishTimeout)
+	defer cancel()
+
+	return ch.PublishConfirmed(ctx,
+		deadLetterExchangeName,
+		"",
+		amqp.Publishing{
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+		})
+}
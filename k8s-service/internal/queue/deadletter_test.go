@@ -0,0 +1,217 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/queue"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// published is a message republished by the queue.
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+// fakePublisher records republished messages. err fails the publish itself,
+// nack has the broker reject the message after it was sent.
+type fakePublisher struct {
+	messages []published
+	err      error
+	nack     bool
+}
+
+func (p *fakePublisher) PublishConfirmed(_ context.Context, exchange, key string, msg amqp.Publishing) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, published{exchange: exchange, key: key, msg: msg})
+	if p.nack {
+		return errors.New("broker rejected the message")
+	}
+	return nil
+}
+
+// fakeAcknowledger records how a delivery was settled.
+type fakeAcknowledger struct {
+	acked, requeued, rejected bool
+}
+
+func (a *fakeAcknowledger) Ack(uint64, bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	a.requeued = requeue
+	a.rejected = !requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(_ uint64, requeue bool) error {
+	return a.Nack(0, false, requeue)
+}
+
+var _ = Describe("Dead-lettering", func() {
+	DescribeTable("should classify errors",
+		func(err error, reason string, retryable bool) {
+			gotReason, gotRetryable := queue.ClassifyError(err)
+			Expect(gotReason).To(Equal(reason))
+			Expect(gotRetryable).To(Equal(retryable))
+		},
+		Entry("invalid resources", fmt.Errorf("%w: unknown preset", kube.ErrInvalidResources), queue.ReasonInvalidResources, false),
+		Entry("invalid game", fmt.Errorf("%w: bots", kube.ErrInvalidGame), queue.ReasonInvalidGame, false),
+		Entry("spec mismatch", kube.ErrSpecMismatch, queue.ReasonSpecMismatch, false),
+		Entry("terminating job", kube.ErrJobTerminating, queue.ReasonJobTerminating, true),
+		Entry("presign failure", fmt.Errorf("%w: timeout", kube.ErrPresignFailed), queue.ReasonPresignFailed, true),
+		Entry("rejected job", fmt.Errorf("%w: forbidden", kube.ErrCreateJobFailed), queue.ReasonKubeCreateFailed, true),
+		Entry("no free slot", fmt.Errorf("%w: 4 games running", kube.ErrNoCapacity), queue.ReasonNoCapacity, true),
+		Entry("anything else", errors.New("boom"), queue.ReasonProcessingFailed, true),
+	)
+
+	Describe("handling failures", func() {
+		var (
+			q    *queue.Queue
+			ch   *fakePublisher
+			ack  *fakeAcknowledger
+			body = []byte(`{"pattern": "new_match", "data": {}}`)
+		)
+
+		delivery := func(headers amqp.Table) amqp.Delivery {
+			return amqp.Delivery{
+				Acknowledger: ack,
+				Headers:      headers,
+				RoutingKey:   "routed-elsewhere",
+				ContentType:  "application/json",
+				Body:         body,
+			}
+		}
+
+		BeforeEach(func() {
+			q = queue.NewFailureQueue(3, 30*time.Second, zap.NewNop().Sugar())
+			ch = &fakePublisher{}
+			ack = &fakeAcknowledger{}
+		})
+
+		It("should delay the retry of a temporary failure in the lane's retry queue", func() {
+			queue.HandleFailure(q, ch, delivery(amqp.Table{"x-retry-count": int64(1)}), "game_queue", kube.ErrCreateJobFailed)
+
+			Expect(ch.messages).To(HaveLen(1))
+			retry := ch.messages[0]
+			Expect(retry.exchange).To(BeEmpty())
+			Expect(retry.key).To(Equal("game_queue.retry"))
+			Expect(retry.msg.Expiration).To(Equal("30000"))
+			Expect(retry.msg.Headers).To(HaveKeyWithValue("x-retry-count", int64(2)))
+			Expect(retry.msg.Body).To(Equal(body))
+			Expect(ack.acked).To(BeTrue())
+		})
+
+		It("should count redeliveries of the broker towards the retries", func() {
+			queue.HandleFailure(q, ch, delivery(amqp.Table{"x-retry-count": int64(2), "x-delivery-count": int64(1)}),
+				"game_queue_tournament", kube.ErrCreateJobFailed)
+
+			Expect(ch.messages).To(HaveLen(1))
+			dead := ch.messages[0]
+			Expect(dead.exchange).To(Equal("game_queue.dlx"))
+			Expect(dead.msg.Headers).To(HaveKeyWithValue("x-failure-reason", queue.ReasonKubeCreateFailed))
+			Expect(dead.msg.Headers).To(HaveKeyWithValue("x-failure-retryable", true))
+			Expect(dead.msg.Headers).To(HaveKeyWithValue("x-delivery-count", int64(3)))
+			Expect(dead.msg.Headers).To(HaveKeyWithValue("x-original-queue", "game_queue_tournament"))
+			Expect(dead.msg.Headers).NotTo(HaveKey("x-retry-count"))
+			Expect(ack.acked).To(BeTrue())
+		})
+
+		It("should defer games without a free slot without using up a retry", func() {
+			headers := amqp.Table{"x-retry-count": int64(3), "x-delivery-count": int64(1)}
+			queue.HandleFailure(q, ch, delivery(headers), "game_queue_tournament", fmt.Errorf("%w: 4 games running", kube.ErrNoCapacity))
+
+			Expect(ch.messages).To(HaveLen(1))
+			deferred := ch.messages[0]
+			Expect(deferred.key).To(Equal("game_queue_tournament.retry"))
+			Expect(deferred.msg.Expiration).To(Equal("30000"))
+			Expect(deferred.msg.Headers).To(HaveKeyWithValue("x-retry-count", int64(3)))
+			Expect(deferred.msg.Headers).NotTo(HaveKey("x-delivery-count"))
+			Expect(ack.acked).To(BeTrue())
+		})
+
+		It("should dead-letter permanent failures right away", func() {
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", fmt.Errorf("%w: bots", kube.ErrInvalidGame))
+
+			Expect(ch.messages).To(HaveLen(1))
+			Expect(ch.messages[0].exchange).To(Equal("game_queue.dlx"))
+			Expect(ch.messages[0].msg.Headers).To(HaveKeyWithValue("x-failure-reason", queue.ReasonInvalidGame))
+			Expect(ch.messages[0].msg.Headers).To(HaveKeyWithValue("x-original-queue", "game_queue"))
+			Expect(ack.acked).To(BeTrue())
+		})
+
+		It("should requeue the message if it cannot be republished", func() {
+			ch.err = errors.New("channel closed")
+
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", kube.ErrCreateJobFailed)
+			Expect(ack.acked).To(BeFalse())
+			Expect(ack.requeued).To(BeTrue())
+
+			ack = &fakeAcknowledger{}
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", kube.ErrInvalidGame)
+			Expect(ack.acked).To(BeFalse())
+			Expect(ack.requeued).To(BeTrue())
+		})
+
+		It("should requeue the message if the broker rejects the copy", func() {
+			ch.nack = true
+
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", kube.ErrCreateJobFailed)
+			Expect(ch.messages).To(HaveLen(1))
+			Expect(ack.acked).To(BeFalse())
+			Expect(ack.requeued).To(BeTrue())
+
+			ack = &fakeAcknowledger{}
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", fmt.Errorf("%w: 4 games running", kube.ErrNoCapacity))
+			Expect(ack.acked).To(BeFalse())
+			Expect(ack.requeued).To(BeTrue())
+
+			ack = &fakeAcknowledger{}
+			queue.HandleFailure(q, ch, delivery(nil), "game_queue", kube.ErrInvalidGame)
+			Expect(ack.acked).To(BeFalse())
+			Expect(ack.requeued).To(BeTrue())
+		})
+	})
+
+	Describe("recording deliveries", func() {
+		var q *queue.Queue
+
+		BeforeEach(func() {
+			q = queue.NewFailureQueue(3, time.Second, zap.NewNop().Sugar())
+		})
+
+		It("should count temporary failures until a delivery succeeds", func() {
+			queue.RecordDelivery(q, kube.ErrCreateJobFailed)
+			queue.RecordDelivery(q, fmt.Errorf("%w: 4 games running", kube.ErrNoCapacity))
+			queue.RecordDelivery(q, kube.ErrPresignFailed)
+
+			status := q.ConsumerStatus()
+			Expect(status.ConsecutiveFailures).To(Equal(2))
+			Expect(status.LastFailure).To(MatchError(kube.ErrPresignFailed))
+
+			queue.RecordDelivery(q, nil)
+			status = q.ConsumerStatus()
+			Expect(status.ConsecutiveFailures).To(BeZero())
+			Expect(status.LastFailure).To(BeNil())
+			Expect(status.LastDelivery).NotTo(BeZero())
+		})
+
+		It("should ignore messages that can never be scheduled", func() {
+			queue.RecordDelivery(q, fmt.Errorf("%w: bots", kube.ErrInvalidGame))
+
+			Expect(q.ConsumerStatus().ConsecutiveFailures).To(BeZero())
+			Expect(q.ConsumerStatus().LastFailure).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// LaneScheduler exposes the lane scheduler to tests.
+type LaneScheduler struct {
+	s *laneScheduler
+}
+
+func NewLaneScheduler(tournament, casual <-chan amqp.Delivery, weight int) *LaneScheduler {
+	return &LaneScheduler{s: newLaneScheduler(tournament, casual, weight)}
+}
+
+// Next returns the body and queue of the next delivery.
+func (s *LaneScheduler) Next() (string, string, bool) {
+	d, l, ok := s.s.next()
+	return string(d.Body), l.queue, ok
+}
+
+// FailChannel makes the broker close the queue's current channel with a
+// channel error, like it does when the consumer_timeout expires.
+func FailChannel(q *Queue) error {
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+	_, err = ch.QueueDeclarePassive("k8s-service.missing-queue", false, false, false, false, nil)
+	return err
+}
+
+// Publish sends body to the game queue.
+func Publish(q *Queue, body []byte) error {
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+	return ch.Publish("", gameQueueName, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
+}
+
+// Publisher is the channel failed deliveries are republished on.
+type Publisher = publisher
+
+// ClassifyError returns the failure reason of err and whether it is retried.
+func ClassifyError(err error) (string, bool) {
+	dErr := classifyError(err)
+	return dErr.reason, dErr.retryable
+}
+
+// NewFailureQueue returns a queue that is only fit for handling failures.
+func NewFailureQueue(maxRetries int64, retryDelay time.Duration, logger *zap.SugaredLogger) *Queue {
+	return &Queue{maxRetries: maxRetries, retryDelay: retryDelay, logger: logger}
+}
+
+// HandleFailure handles a delivery consumed from queueName that failed with err.
+func HandleFailure(q *Queue, ch Publisher, d amqp.Delivery, queueName string, err error) {
+	l := casualLane
+	if queueName == tournamentLane.queue {
+		l = tournamentLane
+	}
+	q.handleFailure(ch, d, l, "new_match", err)
+}
+
+// NewGameRouter returns the game_queue router without a Kubernetes client.
+// Only messages that are rejected before a handler reaches the cluster may
+// be dispatched to it.
+func NewGameRouter(logger *zap.SugaredLogger) *Router {
+	return (&Queue{logger: logger}).newGameRouter(nil)
+}
+
+// Pattern returns the pattern body is recorded under in metrics.
+func Pattern(r *Router, body []byte) string {
+	return r.pattern(body)
+}
+
+// RecordDelivery records the outcome of a delivery for the health checks.
+func RecordDelivery(q *Queue, err error) {
+	q.recordDelivery(err)
+}
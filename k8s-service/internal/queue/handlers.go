@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+)
+
+// Patterns accepted on game_queue.
+const (
+	// PatternNewMatch schedules a new game. The API sends "new_match"; the
+	// older "new_game" and "start" are accepted as aliases.
+	PatternNewMatch = "new_match"
+	PatternNewGame  = "new_game"
+	PatternStart    = "start"
+	// PatternCancelGame cancels a scheduled or running game.
+	PatternCancelGame = "cancel_game"
+	// PatternRerunGame deletes a game's Job, if any, and schedules it again.
+	PatternRerunGame = "rerun_game"
+)
+
+// newGameRouter registers the handlers of all game_queue patterns.
+func (q *Queue) newGameRouter(kubeClient *kube.Client) *Router {
+	router := NewRouter()
+	router.Handle(q.newGameHandler(kubeClient), PatternNewMatch, PatternNewGame, PatternStart)
+	router.Handle(q.cancelGameHandler(kubeClient), PatternCancelGame)
+	router.Handle(rerunGameHandler(kubeClient), PatternRerunGame)
+	return router
+}
+
+func (q *Queue) newGameHandler(kubeClient *kube.Client) HandlerFunc {
+	return func(ctx context.Context, data json.RawMessage) error {
+		game, err := parseGameMessage(data)
+		if err != nil {
+			return permanentError(ReasonParseError, err)
+		}
+		if game.Priority == "" {
+			game.Priority = lanePriority(ctx)
+		}
+		// Games that find no free slot within CAPACITY_WAIT are deferred.
+		if err := kubeClient.WaitForCapacity(ctx); err != nil {
+			return err
+		}
+		cancelled, err := kubeClient.GameCancelled(ctx, game.ID)
+		if err != nil {
+			return err
+		}
+		if cancelled {
+			q.logger.Infow("Skipping game cancelled before it was scheduled", "gameID", game.ID)
+			return nil
+		}
+		return kubeClient.CreateGameJob(&game)
+	}
+}
+
+func (q *Queue) cancelGameHandler(kubeClient *kube.Client) HandlerFunc {
+	return func(ctx context.Context, data json.RawMessage) error {
+		cancel, err := parseCancelGameMessage(data)
+		if err != nil {
+			return permanentError(ReasonParseError, err)
+		}
+		cancelled, err := kubeClient.CancelGame(ctx, cancel.ID)
+		if err != nil {
+			return err
+		}
+		if !cancelled {
+			q.logger.Infow("No scheduled or running game to cancel", "gameID", cancel.ID)
+		}
+		return nil
+	}
+}
+
+func rerunGameHandler(kubeClient *kube.Client) HandlerFunc {
+	return func(ctx context.Context, data json.RawMessage) error {
+		game, err := parseGameMessage(data)
+		if err != nil {
+			return permanentError(ReasonParseError, err)
+		}
+		if game.Priority == "" {
+			game.Priority = lanePriority(ctx)
+		}
+		return kubeClient.RerunGame(ctx, &game)
+	}
+}
@@ -1,41 +1,126 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
 	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
 
+const (
+	gameQueueName    = "game_queue"
+	resultsQueueName = "game_results"
+
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
 type Queue struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	gameQ     *amqp.Queue
-	logger    *zap.SugaredLogger
-	mu        sync.Mutex
-	connected bool
+	url        string
+	maxRetries int64
+	retryDelay time.Duration
+	laneWeight int
+	conn       *amqp.Connection
+	ch         *amqp.Channel
+	logger     *zap.SugaredLogger
+	mu         sync.Mutex
+	connected  bool
+	closing    bool
+
+	// declared and kubeClient remember what has been set up on the current
+	// channel, so the supervisor can restore it after a reconnect.
+	declared   bool
+	kubeClient *kube.Client
+
+	// consumeCtx is cancelled once the consumers are stopped, interrupting a
+	// game that waits for capacity. consuming tracks the consumer goroutines.
+	consumeCtx    context.Context
+	stopConsumers context.CancelFunc
+	consuming     sync.WaitGroup
+	// stopChannelConsumer interrupts the consumer of the current channel once
+	// the channel is lost.
+	stopChannelConsumer context.CancelFunc
+
+	// Reported by the health checks. consumers counts the running consumer
+	// goroutines, the one of a lost channel may still be finishing.
+	consumers     int
+	lastDelivery  time.Time
+	lastFailure   error
+	lastFailureAt time.Time
+	// failedDeliveries counts the temporary failures since the last
+	// successful delivery.
+	failedDeliveries int
 }
 
 // ConnectionStatus returns true if connected to RabbitMQ
 func (q *Queue) ConnectionStatus() bool {
-	if q.ch == nil {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.connected || q.ch == nil {
 		return false
 	}
 	return !q.ch.IsClosed()
 }
 
-func Init(url string, logger *zap.SugaredLogger) (*Queue, error) {
+func Init(cfg *config.Config, logger *zap.SugaredLogger) (*Queue, error) {
+	consumeCtx, stopConsumers := context.WithCancel(context.Background())
 	queue := &Queue{
-		logger:    logger,
-		connected: false,
+		url:        cfg.RabbitMQ,
+		maxRetries: cfg.GameMaxRetries,
+		retryDelay: cfg.GameRetryDelay,
+		laneWeight: cfg.TournamentLaneWeight,
+		logger:     logger,
+		connected:  false,
+
+		consumeCtx:    consumeCtx,
+		stopConsumers: stopConsumers,
 	}
 
-	conn, err := amqp.Dial(url)
+	connClosed, chLost, err := queue.connect()
 	if err != nil {
 		return nil, err
 	}
 
+	go queue.supervise(connClosed, chLost)
+
+	return queue, nil
+}
+
+// connect dials RabbitMQ and opens a fresh channel. connClosed receives a
+// value once the connection is lost, chLost once the channel is.
+func (q *Queue) connect() (connClosed chan *amqp.Error, chLost <-chan error, err error) {
+	conn, err := amqp.Dial(q.url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chLost, err = q.openChannel(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	connClosed = conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	q.mu.Lock()
+	q.conn = conn
+	q.connected = true
+	q.mu.Unlock()
+
+	return connClosed, chLost, nil
+}
+
+// openChannel opens a channel on conn and makes it the current one. The
+// returned channel receives a value once the channel is closed or the broker
+// cancels one of its consumers.
+func (q *Queue) openChannel(conn *amqp.Connection) (<-chan error, error) {
 	ch, err := conn.Channel()
 	if err != nil {
 		return nil, err
@@ -47,33 +132,227 @@ func Init(url string, logger *zap.SugaredLogger) (*Queue, error) {
 		false,
 	)
 	if err != nil {
+		_ = ch.Close()
 		return nil, err
 	}
 
-	queue.conn = conn
-	queue.ch = ch
-	queue.connected = true
+	// Failed deliveries are republished on this channel and only
+	// acknowledged once the broker confirms the copy.
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
 
-	return queue, nil
+	chLost := watchChannel(ch)
+
+	q.mu.Lock()
+	q.ch = ch
+	q.mu.Unlock()
+
+	return chLost, nil
+}
+
+// watchChannel reports the first close or consumer cancellation of ch. The
+// broker closes a channel on errors like an expired consumer_timeout and
+// cancels consumers e.g. when their queue is deleted; either way the game
+// queue consumer stops.
+func watchChannel(ch *amqp.Channel) <-chan error {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	cancelled := ch.NotifyCancel(make(chan string, 1))
+
+	lost := make(chan error, 1)
+	go func() {
+		report := func(err error) {
+			select {
+			case lost <- err:
+			default:
+			}
+		}
+		// Keep draining both until the channel is closed, the library blocks
+		// on notifications nobody receives.
+		for closed != nil || cancelled != nil {
+			select {
+			case amqpErr, ok := <-closed:
+				closed = nil
+				if ok {
+					report(amqpErr)
+				} else {
+					report(errors.New("channel closed"))
+				}
+			case tag, ok := <-cancelled:
+				if !ok {
+					cancelled = nil
+					continue
+				}
+				report(fmt.Errorf("consumer %s cancelled by the broker", tag))
+			}
+		}
+	}()
+	return lost
+}
+
+// supervise waits for the connection or the channel to drop and restores
+// them, declaring the queues and restarting the consumer again afterwards.
+// A lost channel is reopened on the same connection if it is still open, a
+// lost connection is re-established with exponential backoff.
+func (q *Queue) supervise(connClosed chan *amqp.Error, chLost <-chan error) {
+	for {
+		connLost := false
+		select {
+		case amqpErr, ok := <-connClosed:
+			connLost = true
+			if ok {
+				q.logger.Warnw("RabbitMQ connection lost, reconnecting", "error", amqpErr)
+			} else {
+				q.logger.Warn("RabbitMQ connection closed, reconnecting")
+			}
+		case err := <-chLost:
+			if !q.isClosing() {
+				q.logger.Warnw("RabbitMQ channel lost, restoring", "error", err)
+			}
+		}
+
+		q.mu.Lock()
+		if connLost {
+			q.connected = false
+		}
+		closing := q.closing
+		q.mu.Unlock()
+		if closing {
+			return
+		}
+		q.stopConsumer()
+
+		if !connLost {
+			newChLost, err := q.reopenChannel()
+			if err == nil {
+				chLost = newChLost
+				q.logger.Info("RabbitMQ channel re-established")
+				continue
+			}
+			q.logger.Warnw("Failed to restore RabbitMQ channel, reconnecting", "error", err)
+			q.closeConnection()
+		}
+
+		connClosed, chLost = q.reconnect()
+		if connClosed == nil {
+			return
+		}
+		q.logger.Info("RabbitMQ connection re-established")
+		metrics.AMQPReconnects.Inc()
+	}
+}
+
+// reopenChannel replaces the current channel by a new one on the same
+// connection and restores everything registered on it.
+func (q *Queue) reopenChannel() (<-chan error, error) {
+	q.mu.Lock()
+	conn, ch := q.conn, q.ch
+	q.mu.Unlock()
+
+	if conn == nil || conn.IsClosed() {
+		return nil, errors.New("RabbitMQ connection is closed")
+	}
+	// A consumer cancelled by the broker leaves the channel open, close it so
+	// the remaining consumer stops as well before both are consumed again.
+	if ch != nil && !ch.IsClosed() {
+		_ = ch.Close()
+	}
+
+	chLost, err := q.openChannel(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.restore(); err != nil {
+		return nil, err
+	}
+	return chLost, nil
+}
+
+// reconnect retries until the connection and everything registered on it is
+// restored. It returns nil if the queue is closed in the meantime.
+func (q *Queue) reconnect() (chan *amqp.Error, <-chan error) {
+	delay := minReconnectDelay
+	for {
+		time.Sleep(delay)
+
+		if q.isClosing() {
+			return nil, nil
+		}
+
+		connClosed, chLost, err := q.connect()
+		if err == nil {
+			err = q.restore()
+			if err != nil {
+				q.closeConnection()
+			}
+		}
+		if err == nil {
+			return connClosed, chLost
+		}
+
+		q.logger.Errorw("Failed to reconnect to RabbitMQ", "error", err, "retryIn", delay)
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// restore re-runs the queue declarations and the consumer on a new channel.
+func (q *Queue) restore() error {
+	q.mu.Lock()
+	declared := q.declared
+	kubeClient := q.kubeClient
+	q.mu.Unlock()
+
+	if declared {
+		if err := q.DeclareQueues(); err != nil {
+			return err
+		}
+	}
+	if kubeClient != nil {
+		if err := q.ConsumeGameQueue(q.logger, kubeClient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// channel returns the current AMQP channel.
+func (q *Queue) channel() (*amqp.Channel, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.ch == nil || q.ch.IsClosed() {
+		return nil, errors.New("RabbitMQ channel is not open")
+	}
+	return q.ch, nil
 }
 
 func (q *Queue) DeclareQueues() error {
-	newQueue, err := q.ch.QueueDeclare(
-		"game_queue",
-		true,
-		false,
-		false,
-		false,
-		amqp.Table{
-			amqp.QueueTypeArg: amqp.QueueTypeQuorum,
-		})
+	ch, err := q.channel()
 	if err != nil {
 		return err
 	}
-	q.gameQ = &newQueue
 
-	_, err = q.ch.QueueDeclare(
-		"game_results",
+	for _, l := range []lane{casualLane, tournamentLane} {
+		_, err = ch.QueueDeclare(
+			l.queue,
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				amqp.QueueTypeArg: amqp.QueueTypeQuorum,
+			})
+		if err != nil {
+			return err
+		}
+		if err = declareRetryQueue(ch, l); err != nil {
+			return err
+		}
+	}
+
+	_, err = ch.QueueDeclare(
+		resultsQueueName,
 		true,
 		false,
 		false,
@@ -85,59 +364,209 @@ func (q *Queue) DeclareQueues() error {
 		return err
 	}
 
+	err = q.declareDeadLetter(ch)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.declared = true
+	q.mu.Unlock()
+
 	return nil
 }
 
 func (q *Queue) ConsumeGameQueue(logger *zap.SugaredLogger, kubeClient *kube.Client) error {
-	msgs, err := q.ch.Consume(
-		q.gameQ.Name,
-		"",
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	declared := q.declared
+	q.mu.Unlock()
+	if !declared {
+		return errors.New("game queues have not been declared")
+	}
+
+	// With a prefetch of 1 per consumer each lane holds at most one message,
+	// the scheduler decides which one is handled next.
+	tournament, err := ch.Consume(
+		tournamentLane.queue,
+		tournamentLane.consumerTag(),
+		false,
+		false,
+		false,
+		false,
+		nil)
+	if err != nil {
+		return err
+	}
+	casual, err := ch.Consume(
+		casualLane.queue,
+		casualLane.consumerTag(),
 		false,
 		false,
 		false,
 		false,
 		nil)
 	if err != nil {
+		// Nothing would read the deliveries of the tournament lane.
+		if cancelErr := ch.Cancel(tournamentLane.consumerTag(), false); cancelErr != nil {
+			q.logger.Warnw("Failed to cancel tournament consumer", "error", cancelErr)
+		}
 		return err
 	}
+	lanes := newLaneScheduler(tournament, casual, q.laneWeight)
+
+	q.mu.Lock()
+	q.kubeClient = kubeClient
+	q.mu.Unlock()
+
+	router := q.newGameRouter(kubeClient)
+
+	// Handlers of this channel are interrupted once it is lost, their
+	// deliveries can no longer be acknowledged anyway.
+	ctx, stop := context.WithCancel(q.consumeCtx)
+	q.mu.Lock()
+	q.stopChannelConsumer = stop
+	q.mu.Unlock()
 
+	q.consuming.Add(1)
+	q.addConsumer(1)
 	go func() {
-		for d := range msgs {
-			logger.Info(string(d.Body))
+		defer q.consuming.Done()
+		defer q.addConsumer(-1)
+		defer stop()
+		for {
+			d, l, ok := lanes.next()
+			if !ok {
+				break
+			}
+			pattern := router.pattern(d.Body)
+			metrics.MessagesConsumed.WithLabelValues(l.queue, pattern).Inc()
 
-			game, err := parseGameMessage(d.Body)
-			if err != nil {
-				logger.Errorln("Failed to parse game message", zap.Error(err))
+			// Deliveries that arrived before the consumers were cancelled go
+			// back to the queue for another replica.
+			if q.isClosing() {
+				q.requeue(d, pattern)
 				continue
 			}
+			logger.Infow(string(d.Body), "queue", l.queue)
 
-			err = kubeClient.CreateGameJob(&game)
+			err := router.Dispatch(withLane(ctx, l), d.Body)
+			if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+				logger.Infow("Requeueing interrupted game message", "queue", l.queue)
+				q.requeue(d, pattern)
+				continue
+			}
 			if err != nil {
-				logger.Errorln("Failed to create game job", zap.Error(err))
+				if !errors.Is(err, kube.ErrNoCapacity) {
+					logger.Errorln("Failed to handle game queue message", zap.Error(err))
+				}
+				q.recordDelivery(err)
+				q.handleFailure(confirmingChannel{ch}, d, l, pattern, err)
 				continue
 			}
 
 			err = d.Ack(false)
 			if err != nil {
 				logger.Errorln("There was an error during Acknowledgement", zap.Error(err), zap.Any("delivery", d))
+			} else {
+				metrics.MessagesAcked.WithLabelValues(pattern).Inc()
 			}
+			q.recordDelivery(err)
 		}
+		logger.Warn("Game queue consumer stopped")
 	}()
 	return nil
 }
 
+// stopConsumer interrupts the handler of the consumer on the lost channel.
+func (q *Queue) stopConsumer() {
+	q.mu.Lock()
+	stop := q.stopChannelConsumer
+	q.stopChannelConsumer = nil
+	q.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
+
+func (q *Queue) isClosing() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.closing
+}
+
+// requeue returns a delivery that was interrupted by the shutdown to the queue.
+func (q *Queue) requeue(d amqp.Delivery, pattern string) {
+	if err := d.Nack(false, true); err != nil {
+		q.logger.Errorw("Failed to requeue game message", "error", err)
+		return
+	}
+	metrics.MessagesNacked.WithLabelValues(pattern, reasonShutdown, metrics.ActionRequeued).Inc()
+}
+
+// StopConsuming cancels the game queue consumers and waits until the delivery
+// being handled has been acknowledged. A game waiting for capacity is
+// requeued. The connection is no longer restored afterwards.
+func (q *Queue) StopConsuming(ctx context.Context) error {
+	q.mu.Lock()
+	q.closing = true
+	ch := q.ch
+	q.mu.Unlock()
+
+	q.stopConsumers()
+	if ch != nil && !ch.IsClosed() {
+		for _, l := range []lane{tournamentLane, casualLane} {
+			if err := ch.Cancel(l.consumerTag(), false); err != nil {
+				q.logger.Errorw("Failed to cancel consumer", "queue", l.queue, "error", err)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.consuming.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.logger.Info("Game queue consumers stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for in-flight deliveries: %w", ctx.Err())
+	}
+}
+
+// closeConnection closes the current connection without stopping the supervisor.
+func (q *Queue) closeConnection() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.conn != nil {
+		_ = q.conn.Close()
+	}
+	q.connected = false
+}
+
 // CloseConnection cleanly closes the RabbitMQ connection
 func (q *Queue) CloseConnection() error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if q.ch != nil {
+	q.closing = true
+
+	if q.ch != nil && !q.ch.IsClosed() {
 		if err := q.ch.Close(); err != nil {
 			return err
 		}
 	}
 
-	if q.conn != nil {
+	if q.conn != nil && !q.conn.IsClosed() {
 		if err := q.conn.Close(); err != nil {
 			return err
 		}
@@ -146,3 +575,67 @@ func (q *Queue) CloseConnection() error {
 	q.connected = false
 	return nil
 }
+
+// ConsumerStatus describes the game queue consumer for health checks.
+type ConsumerStatus struct {
+	Connected bool
+	// Started is set once ConsumeGameQueue has succeeded.
+	Started bool
+	Running bool
+	Closing bool
+	// LastDelivery is when a delivery was last acknowledged.
+	LastDelivery time.Time
+	// LastFailure is the error of the latest delivery if it failed for a
+	// reason that may be temporary, and nil once a delivery succeeds.
+	LastFailure   error
+	LastFailureAt time.Time
+	// ConsecutiveFailures counts the deliveries that failed in a row.
+	ConsecutiveFailures int
+}
+
+func (q *Queue) ConsumerStatus() ConsumerStatus {
+	connected := q.ConnectionStatus()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return ConsumerStatus{
+		Connected:    connected,
+		Started:      q.kubeClient != nil,
+		Running:      q.consumers > 0,
+		Closing:      q.closing,
+		LastDelivery: q.lastDelivery,
+		LastFailure:  q.lastFailure,
+
+		LastFailureAt:       q.lastFailureAt,
+		ConsecutiveFailures: q.failedDeliveries,
+	}
+}
+
+func (q *Queue) addConsumer(delta int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.consumers += delta
+}
+
+// recordDelivery remembers the outcome of a delivery. Messages that can never
+// be scheduled say nothing about the health of k8s-service and are ignored.
+func (q *Queue) recordDelivery(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		q.lastDelivery = time.Now()
+		q.lastFailure = nil
+		q.failedDeliveries = 0
+	case errors.Is(err, kube.ErrNoCapacity):
+		// The game was deferred, which is no failure of k8s-service.
+		q.lastDelivery = time.Now()
+	case classifyError(err).retryable:
+		q.lastFailure = err
+		q.lastFailureAt = time.Now()
+		q.failedDeliveries++
+	}
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const tournamentQueueName = "game_queue_tournament"
+
+// lane is a game queue whose messages default to the lane's priority.
+type lane struct {
+	queue    string
+	priority string
+}
+
+var (
+	casualLane     = lane{queue: gameQueueName, priority: kube.PriorityCasual}
+	tournamentLane = lane{queue: tournamentQueueName, priority: kube.PriorityTournament}
+)
+
+// consumerTag identifies the lane's consumer on a channel.
+func (l lane) consumerTag() string {
+	return "k8s-service." + l.queue
+}
+
+type laneKey struct{}
+
+func withLane(ctx context.Context, l lane) context.Context {
+	return context.WithValue(ctx, laneKey{}, l)
+}
+
+// lanePriority returns the priority of the lane the message being handled
+// was consumed from.
+func lanePriority(ctx context.Context) string {
+	if l, ok := ctx.Value(laneKey{}).(lane); ok {
+		return l.priority
+	}
+	return kube.PriorityCasual
+}
+
+// laneScheduler picks the next delivery from the tournament and casual lanes.
+// While both have messages waiting, weight tournament messages are taken for
+// every casual one, so casual games are delayed but never starved.
+type laneScheduler struct {
+	tournament <-chan amqp.Delivery
+	casual     <-chan amqp.Delivery
+	weight     int
+	// streak counts the tournament messages taken since the last casual one.
+	streak int
+}
+
+func newLaneScheduler(tournament, casual <-chan amqp.Delivery, weight int) *laneScheduler {
+	return &laneScheduler{
+		tournament: tournament,
+		casual:     casual,
+		weight:     max(weight, 1),
+	}
+}
+
+// next blocks until a delivery is available and returns it with its lane. It
+// returns false once both lanes have been closed.
+func (s *laneScheduler) next() (amqp.Delivery, lane, bool) {
+	for s.tournament != nil || s.casual != nil {
+		first, second := &s.tournament, &s.casual
+		if s.streak >= s.weight {
+			first, second = second, first
+		}
+
+		// Take from the preferred lane if it has a message, then from the other one.
+		for _, ch := range []*<-chan amqp.Delivery{first, second} {
+			if *ch == nil {
+				continue
+			}
+			select {
+			case d, ok := <-*ch:
+				if d, l, ok := s.take(ch, d, ok); ok {
+					return d, l, true
+				}
+			default:
+			}
+		}
+
+		if s.tournament == nil && s.casual == nil {
+			break
+		}
+
+		// Neither lane has a message, wait for the first one.
+		select {
+		case d, ok := <-s.tournament:
+			if d, l, ok := s.take(&s.tournament, d, ok); ok {
+				return d, l, true
+			}
+		case d, ok := <-s.casual:
+			if d, l, ok := s.take(&s.casual, d, ok); ok {
+				return d, l, true
+			}
+		}
+	}
+	return amqp.Delivery{}, lane{}, false
+}
+
+// take records a delivery received from ch. A closed lane is removed.
+func (s *laneScheduler) take(ch *<-chan amqp.Delivery, d amqp.Delivery, ok bool) (amqp.Delivery, lane, bool) {
+	if !ok {
+		*ch = nil
+		return d, lane{}, false
+	}
+	if ch == &s.tournament {
+		s.streak++
+		return d, tournamentLane, true
+	}
+	s.streak = 0
+	return d, casualLane, true
+}
@@ -0,0 +1,60 @@
+package queue_test
+
+import (
+	"fmt"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/queue"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var _ = Describe("Lanes", func() {
+	fill := func(prefix string, n int) chan amqp.Delivery {
+		ch := make(chan amqp.Delivery, n)
+		for i := range n {
+			ch <- amqp.Delivery{Body: fmt.Appendf(nil, "%s%d", prefix, i)}
+		}
+		return ch
+	}
+
+	drain := func(s *queue.LaneScheduler, n int) []string {
+		var bodies []string
+		for range n {
+			body, _, ok := s.Next()
+			Expect(ok).To(BeTrue())
+			bodies = append(bodies, body)
+		}
+		return bodies
+	}
+
+	It("should take weight tournament messages for every casual one", func() {
+		s := queue.NewLaneScheduler(fill("t", 6), fill("c", 3), 2)
+
+		Expect(drain(s, 9)).To(Equal([]string{"t0", "t1", "c0", "t2", "t3", "c1", "t4", "t5", "c2"}))
+	})
+
+	It("should take casual messages while no tournament message is waiting", func() {
+		tournament := make(chan amqp.Delivery, 1)
+		s := queue.NewLaneScheduler(tournament, fill("c", 2), 4)
+
+		Expect(drain(s, 2)).To(Equal([]string{"c0", "c1"}))
+
+		tournament <- amqp.Delivery{Body: []byte("t0")}
+		body, lane, ok := s.Next()
+		Expect(ok).To(BeTrue())
+		Expect(body).To(Equal("t0"))
+		Expect(lane).To(Equal("game_queue_tournament"))
+	})
+
+	It("should stop once both lanes are closed", func() {
+		tournament, casual := fill("t", 1), fill("c", 1)
+		close(tournament)
+		close(casual)
+		s := queue.NewLaneScheduler(tournament, casual, 1)
+
+		Expect(drain(s, 2)).To(ConsistOf("t0", "c0"))
+		_, _, ok := s.Next()
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -2,16 +2,52 @@ package queue
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	"github.com/google/uuid"
 )
 
-func parseGameMessage(msg []byte) (kube.Game, error) {
-	var gameMessage kube.GameMessage
+// message is the NestJS-style envelope of every message on game_queue.
+type message struct {
+	Pattern string          `json:"pattern"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// cancelGameData is the payload of a PatternCancelGame message.
+type cancelGameData struct {
+	ID uuid.UUID `json:"id"`
+}
+
+func parseMessage(msg []byte) (message, error) {
+	var m message
 
-	err := json.Unmarshal(msg, &gameMessage)
+	err := json.Unmarshal(msg, &m)
+	if err != nil {
+		return message{}, err
+	}
+	return m, nil
+}
+
+func parseGameMessage(data json.RawMessage) (kube.Game, error) {
+	var game kube.Game
+
+	err := json.Unmarshal(data, &game)
 	if err != nil {
 		return kube.Game{}, err
 	}
-	return gameMessage.Data, nil
+	return game, nil
+}
+
+func parseCancelGameMessage(data json.RawMessage) (cancelGameData, error) {
+	var cancel cancelGameData
+
+	err := json.Unmarshal(data, &cancel)
+	if err != nil {
+		return cancelGameData{}, err
+	}
+	if cancel.ID == uuid.Nil {
+		return cancelGameData{}, errors.New("missing game id")
+	}
+	return cancel, nil
 }
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/kube"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// resultMessage mirrors the envelope NestJS microservices expect.
+type resultMessage struct {
+	Pattern string `json:"pattern"`
+	Data    any    `json:"data"`
+}
+
+var _ kube.ResultPublisher = (*Queue)(nil)
+
+// PublishResult publishes data with the given pattern to the game_results queue.
+func (q *Queue) PublishResult(ctx context.Context, pattern string, data any) error {
+	body, err := json.Marshal(resultMessage{Pattern: pattern, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal result message: %w", err)
+	}
+
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+
+	return ch.PublishWithContext(ctx,
+		"",
+		resultsQueueName,
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         body,
+		})
+}
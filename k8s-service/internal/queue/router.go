@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+)
+
+// ErrUnknownPattern is returned for messages without a registered handler.
+var ErrUnknownPattern = errors.New("unknown message pattern")
+
+// HandlerFunc processes the data of a message with a registered pattern.
+type HandlerFunc func(ctx context.Context, data json.RawMessage) error
+
+// Router dispatches NestJS-style messages to the handler registered for
+// their pattern.
+type Router struct {
+	handlers map[string]HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+// Handle registers handler for one or more patterns.
+func (r *Router) Handle(handler HandlerFunc, patterns ...string) {
+	for _, pattern := range patterns {
+		r.handlers[pattern] = handler
+	}
+}
+
+// Dispatch parses the message envelope and runs the matching handler.
+func (r *Router) Dispatch(ctx context.Context, body []byte) error {
+	msg, err := parseMessage(body)
+	if err != nil {
+		return permanentError(ReasonParseError, err)
+	}
+
+	handler, ok := r.handlers[msg.Pattern]
+	if !ok {
+		return permanentError(ReasonUnknownPattern, fmt.Errorf("%w: %q", ErrUnknownPattern, msg.Pattern))
+	}
+	return handler(ctx, msg.Data)
+}
+
+// pattern returns the registered pattern of the message for metrics, or
+// metrics.UnknownPattern.
+func (r *Router) pattern(body []byte) string {
+	msg, err := parseMessage(body)
+	if err != nil {
+		return metrics.UnknownPattern
+	}
+	if _, ok := r.handlers[msg.Pattern]; !ok {
+		return metrics.UnknownPattern
+	}
+	return msg.Pattern
+}
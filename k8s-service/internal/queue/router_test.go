@@ -0,0 +1,90 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/metrics"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/queue"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Router", func() {
+	It("should pass the data of a registered pattern to its handler", func() {
+		router := queue.NewRouter()
+		var got []string
+		router.Handle(func(_ context.Context, data json.RawMessage) error {
+			got = append(got, string(data))
+			return nil
+		}, "a", "b")
+
+		Expect(router.Dispatch(context.Background(), []byte(`{"pattern":"a","data":{"id":1}}`))).To(Succeed())
+		Expect(router.Dispatch(context.Background(), []byte(`{"pattern":"b","data":[]}`))).To(Succeed())
+		Expect(got).To(Equal([]string{`{"id":1}`, `[]`}))
+	})
+
+	It("should return the handler's error unchanged", func() {
+		router := queue.NewRouter()
+		handlerErr := errors.New("boom")
+		router.Handle(func(context.Context, json.RawMessage) error { return handlerErr }, "a")
+
+		Expect(router.Dispatch(context.Background(), []byte(`{"pattern":"a"}`))).To(MatchError(handlerErr))
+	})
+
+	Describe("game_queue", func() {
+		var router *queue.Router
+
+		BeforeEach(func() {
+			router = queue.NewGameRouter(zap.NewNop().Sugar())
+		})
+
+		rejected := func(body string) (string, bool) {
+			err := router.Dispatch(context.Background(), []byte(body))
+			Expect(err).To(HaveOccurred())
+			return queue.ClassifyError(err)
+		}
+
+		It("should reject unknown patterns permanently", func() {
+			err := router.Dispatch(context.Background(), []byte(`{"pattern":"delete_everything","data":{}}`))
+			Expect(err).To(MatchError(queue.ErrUnknownPattern))
+			Expect(err).To(MatchError(ContainSubstring(`"delete_everything"`)))
+
+			reason, retryable := queue.ClassifyError(err)
+			Expect(reason).To(Equal(queue.ReasonUnknownPattern))
+			Expect(retryable).To(BeFalse())
+		})
+
+		DescribeTable("should reject malformed messages permanently",
+			func(body, reason string) {
+				got, retryable := rejected(body)
+				Expect(got).To(Equal(reason))
+				Expect(retryable).To(BeFalse())
+			},
+			Entry("invalid JSON", `{"pattern":`, queue.ReasonParseError),
+			Entry("envelope that is not an object", `["new_match"]`, queue.ReasonParseError),
+			Entry("missing pattern", `{"data":{}}`, queue.ReasonUnknownPattern),
+			Entry("new_match with a non-object payload", `{"pattern":"new_match","data":"game"}`, queue.ReasonParseError),
+			Entry("new_game with an invalid id", `{"pattern":"new_game","data":{"id":"not-a-uuid"}}`, queue.ReasonParseError),
+			Entry("start with a mistyped field", `{"pattern":"start","data":{"bots":"many"}}`, queue.ReasonParseError),
+			Entry("cancel_game without an id", `{"pattern":"cancel_game","data":{}}`, queue.ReasonParseError),
+			Entry("cancel_game without data", `{"pattern":"cancel_game"}`, queue.ReasonParseError),
+			Entry("cancel_game with an invalid id", `{"pattern":"cancel_game","data":{"id":42}}`, queue.ReasonParseError),
+			Entry("rerun_game with a non-object payload", `{"pattern":"rerun_game","data":[1,2]}`, queue.ReasonParseError),
+		)
+
+		DescribeTable("should record messages under their pattern",
+			func(body, pattern string) {
+				Expect(queue.Pattern(router, []byte(body))).To(Equal(pattern))
+			},
+			Entry("new_match", `{"pattern":"new_match","data":{}}`, queue.PatternNewMatch),
+			Entry("alias", `{"pattern":"start","data":{}}`, queue.PatternStart),
+			Entry("cancel_game", `{"pattern":"cancel_game","data":{}}`, queue.PatternCancelGame),
+			Entry("rerun_game", `{"pattern":"rerun_game","data":{}}`, queue.PatternRerunGame),
+			Entry("unknown pattern", `{"pattern":"delete_everything"}`, metrics.UnknownPattern),
+			Entry("invalid JSON", `not json`, metrics.UnknownPattern),
+		)
+	})
+})
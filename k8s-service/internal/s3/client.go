@@ -1,82 +1,118 @@
 package s3
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"go.uber.org/zap"
 )
 
-type Client struct {
-	s3Client *minio.Client
-	bucket   string
-	logger   *zap.SugaredLogger
-}
+// Supported storage backends.
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
 
-func NewS3Client(cfg *config.Config, logger *zap.SugaredLogger) (*Client, error) {
-	endpoint, secure := parseEndpoint(cfg.S3Endpoint, cfg.S3Bucket)
+// ErrNotFound is returned when the requested object does not exist.
+var ErrNotFound = errors.New("object not found")
 
-	cli, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.S3AccessKeyID, cfg.S3SecretKey, ""),
-		Secure: secure,
-		Region: cfg.S3Region,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create S3 client: %w", err)
-	}
+// Storage is an object store replays and logs are kept in.
+type Storage interface {
+	// PresignPut returns a URL to upload the object with. The headers have to
+	// be sent with the upload.
+	PresignPut(ctx context.Context, key string, expiry time.Duration, headers http.Header) (string, error)
+	// PresignGet returns a URL to download the object with. params may
+	// override the response's content headers, e.g. response-content-type.
+	PresignGet(ctx context.Context, key string, expiry time.Duration, params url.Values) (string, error)
+	// Stat returns the object's metadata or ErrNotFound.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Put(ctx context.Context, key string, data []byte, opts PutOptions) error
+	// Get returns the object's content or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns all objects below the prefix. The user metadata of listed
+	// objects is not populated.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// SetTags replaces the object's tags without touching its content or
+	// metadata, or returns ErrNotFound.
+	SetTags(ctx context.Context, key string, tags map[string]string) error
+	// GetTags returns the object's tags or ErrNotFound.
+	GetTags(ctx context.Context, key string) (map[string]string, error)
+}
 
-	_, err = cli.HealthCheck(time.Second * 10)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check S3 health: %w", err)
-	}
-	logger.Infoln("Successfully created S3 client with health check")
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	// Metadata is the user metadata, keyed without the x-amz-meta- prefix in
+	// canonical header form (e.g. "Retention").
+	Metadata map[string]string
+}
 
-	return &Client{
-		s3Client: cli,
-		bucket:   cfg.S3Bucket,
-		logger:   logger,
-	}, nil
+// PutOptions are stored together with an object.
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+type Client struct {
+	storage Storage
+	logger  *zap.SugaredLogger
 }
 
-// parseEndpoint returns a clean endpoint host:port and whether to use TLS (https)
-// It also strips any accidental bucket prefix in the provided endpoint path to avoid
-// double-bucket paths on S3-compatible services like StackIT.
-func parseEndpoint(ep, bucket string) (endpoint string, secure bool) {
-	if ep == "" {
-		return ep, true
+// NewClient creates a client on the storage backend selected by STORAGE_BACKEND.
+func NewClient(cfg *config.Config, logger *zap.SugaredLogger) (*Client, error) {
+	var (
+		storage Storage
+		err     error
+	)
+	switch cfg.StorageBackend {
+	case BackendS3, "":
+		storage, err = NewMinioStorage(cfg, logger)
+	case BackendLocal:
+		storage, err = NewLocalStorage(cfg, logger)
+	default:
+		err = fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
 	}
-	// If scheme is missing, assume https
-	if !strings.HasPrefix(ep, "http://") && !strings.HasPrefix(ep, "https://") {
-		ep = "https://" + ep
+	if err != nil {
+		return nil, err
 	}
+	return NewClientWithStorage(storage, logger), nil
+}
 
-	u, err := url.Parse(ep)
-	if err != nil {
-		// Fall back to given string without scheme; default secure true
-		return strings.TrimPrefix(strings.TrimPrefix(ep, "https://"), "http://"), true
+// NewClientWithStorage creates a client on an existing storage backend.
+func NewClientWithStorage(storage Storage, logger *zap.SugaredLogger) *Client {
+	return &Client{
+		storage: storage,
+		logger:  logger,
 	}
+}
 
-	secure = u.Scheme == "https"
+// Handler returns the HTTP handler serving the storage's presigned URLs, or
+// nil if the backend serves them itself.
+func (c *Client) Handler() http.Handler {
+	handler, _ := c.storage.(http.Handler)
+	return handler
+}
 
-	// Normalize path: drop leading bucket segment if present
-	trimmed := strings.Trim(u.Path, "/")
-	if trimmed != "" {
-		segs := strings.Split(trimmed, "/")
-		if len(segs) > 0 && bucket != "" && segs[0] == bucket {
-			segs = segs[1:]
-		}
-		if len(segs) == 0 {
-			u.Path = ""
-		} else {
-			u.Path = "/" + strings.Join(segs, "/")
-		}
-	}
+// healthCheckKey is looked up by Check. It does not need to exist.
+const healthCheckKey = ".health"
 
-	// MinIO expects endpoint without scheme and without path; keep only host[:port]
-	return u.Host, secure
+// Check presigns a download and looks up an object to verify that the
+// storage is reachable with valid credentials.
+func (c *Client) Check(ctx context.Context) error {
+	if _, err := c.storage.PresignGet(ctx, healthCheckKey, time.Minute, nil); err != nil {
+		return fmt.Errorf("failed to presign: %w", err)
+	}
+	if _, err := c.storage.Stat(ctx, healthCheckKey); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to stat: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,445 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"go.uber.org/zap"
+)
+
+// LocalStoragePath is the URL path k8s-service serves the signed URLs of the
+// local storage backend under.
+const LocalStoragePath = "/storage/"
+
+const (
+	// localMetaDir holds the metadata of every object, next to the objects themselves.
+	localMetaDir = ".meta"
+	// localMaxObjectSize limits uploads through signed URLs.
+	localMaxObjectSize = 1 << 30
+
+	signatureParam     = "signature"
+	expiresParam       = "expires"
+	signedHeadersParam = "signed-headers"
+)
+
+// localMeta is stored as JSON for every object of the local storage.
+type localMeta struct {
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	ETag            string            `json:"etag"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Tags            map[string]string `json:"tags,omitempty"`
+}
+
+// LocalStorage stores objects on disk and serves presigned URLs signed with
+// an HMAC key from k8s-service itself. It is meant for local development and
+// tests.
+type LocalStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+	logger  *zap.SugaredLogger
+}
+
+var _ Storage = (*LocalStorage)(nil)
+
+func NewLocalStorage(cfg *config.Config, logger *zap.SugaredLogger) (*LocalStorage, error) {
+	root, err := filepath.Abs(cfg.LocalStoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local storage path: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+
+	secret := []byte(cfg.LocalStorageSecret)
+	if len(secret) == 0 {
+		// URLs signed before a restart become invalid, which is fine for development.
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate local storage secret: %w", err)
+		}
+	}
+
+	logger.Infow("Using local storage", "path", root, "url", cfg.LocalStorageURL)
+	return &LocalStorage{
+		root:    root,
+		baseURL: strings.TrimSuffix(cfg.LocalStorageURL, "/"),
+		secret:  secret,
+		logger:  logger,
+	}, nil
+}
+
+// objectPath returns the file of the object, making sure the key cannot
+// point outside of the storage directory.
+func (s *LocalStorage) objectPath(dir, key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key || strings.HasPrefix(key, localMetaDir+"/") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) paths(key string) (string, string, error) {
+	file, err := s.objectPath(s.root, key)
+	if err != nil {
+		return "", "", err
+	}
+	meta, err := s.objectPath(filepath.Join(s.root, localMetaDir), key)
+	if err != nil {
+		return "", "", err
+	}
+	return file, meta + ".json", nil
+}
+
+func (s *LocalStorage) PresignPut(ctx context.Context, key string, expiry time.Duration, headers http.Header) (string, error) {
+	params := url.Values{}
+	var names []string
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		params.Set(signedHeadersParam, strings.Join(names, ";"))
+	}
+	return s.presign(http.MethodPut, key, expiry, params, headers)
+}
+
+func (s *LocalStorage) PresignGet(ctx context.Context, key string, expiry time.Duration, params url.Values) (string, error) {
+	query := url.Values{}
+	for name, values := range params {
+		query[name] = values
+	}
+	return s.presign(http.MethodGet, key, expiry, query, nil)
+}
+
+func (s *LocalStorage) presign(method, key string, expiry time.Duration, params url.Values, headers http.Header) (string, error) {
+	if _, _, err := s.paths(key); err != nil {
+		return "", err
+	}
+	params.Set(expiresParam, strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+	params.Set(signatureParam, s.sign(method, key, params, headers))
+	return s.baseURL + LocalStoragePath + key + "?" + params.Encode(), nil
+}
+
+// sign computes the signature over the method, the key, all query parameters
+// and the values of the signed headers.
+func (s *LocalStorage) sign(method, key string, params url.Values, headers http.Header) string {
+	query := url.Values{}
+	for name, values := range params {
+		if name != signatureParam {
+			query[name] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, key, query.Encode())
+	if signed := params.Get(signedHeadersParam); signed != "" {
+		for _, name := range strings.Split(signed, ";") {
+			fmt.Fprintf(mac, "%s:%s\n", name, headers.Get(name))
+		}
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves uploads and downloads through URLs signed by PresignPut and PresignGet.
+func (s *LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalStoragePath)
+	params := r.URL.Query()
+
+	expires, err := strconv.ParseInt(params.Get(expiresParam), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "signature expired", http.StatusForbidden)
+		return
+	}
+	expected := s.sign(r.Method, key, params, r.Header)
+	if !hmac.Equal([]byte(expected), []byte(params.Get(signatureParam))) {
+		http.Error(w, "signature mismatch", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.servePut(w, r, key)
+	case http.MethodGet:
+		s.serveGet(w, r, key)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *LocalStorage) servePut(w http.ResponseWriter, r *http.Request, key string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, localMaxObjectSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	opts := PutOptions{
+		ContentType: r.Header.Get("Content-Type"),
+		Metadata:    map[string]string{},
+	}
+	for name := range r.Header {
+		if meta, ok := strings.CutPrefix(http.CanonicalHeaderKey(name), metadataHeaderPrefix); ok {
+			opts.Metadata[meta] = r.Header.Get(name)
+		}
+	}
+	if err := s.put(key, data, opts, r.Header.Get("Content-Encoding")); err != nil {
+		s.logger.Errorw("Failed to store uploaded object", "key", key, "error", err)
+		http.Error(w, "failed to store object", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *LocalStorage) serveGet(w http.ResponseWriter, r *http.Request, key string) {
+	file, metaFile, err := s.paths(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		http.Error(w, "object not found", http.StatusNotFound)
+		return
+	}
+	meta, err := readLocalMeta(metaFile)
+	if err != nil {
+		http.Error(w, "object not found", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+	contentType := meta.ContentType
+	if override := params.Get("response-content-type"); override != "" {
+		contentType = override
+	}
+	contentEncoding := meta.ContentEncoding
+	if override := params.Get("response-content-encoding"); override != "" {
+		contentEncoding = override
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if contentEncoding != "" {
+		w.Header().Set("Content-Encoding", contentEncoding)
+	}
+	w.Header().Set("ETag", `"`+meta.ETag+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, opts PutOptions) error {
+	return s.put(key, data, opts, "")
+}
+
+func (s *LocalStorage) put(key string, data []byte, opts PutOptions, contentEncoding string) error {
+	file, metaFile, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(data)
+	meta, err := json.Marshal(localMeta{
+		ContentType:     opts.ContentType,
+		ContentEncoding: contentEncoding,
+		ETag:            hex.EncodeToString(sum[:]),
+		Metadata:        opts.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(metaFile, meta); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data)
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	file, metaFile, err := s.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	meta, err := readLocalMeta(metaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         meta.ETag,
+		LastModified: info.ModTime(),
+		Metadata:     meta.Metadata,
+	}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	file, _, err := s.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if key == localMetaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || strings.HasSuffix(key, ".tmp") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		object := ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		}
+		if _, metaFile, err := s.paths(key); err == nil {
+			if meta, err := readLocalMeta(metaFile); err == nil {
+				object.ETag = meta.ETag
+			}
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	file, metaFile, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(metaFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	meta, metaFile, err := s.existingMeta(key)
+	if err != nil {
+		return err
+	}
+	meta.Tags = tags
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaFile, data)
+}
+
+func (s *LocalStorage) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	meta, _, err := s.existingMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Tags, nil
+}
+
+// existingMeta returns the metadata of an object and the file it is stored
+// in, or ErrNotFound.
+func (s *LocalStorage) existingMeta(key string) (*localMeta, string, error) {
+	file, metaFile, err := s.paths(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := os.Stat(file); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, "", err
+	}
+	meta, err := readLocalMeta(metaFile)
+	if err != nil {
+		return nil, "", err
+	}
+	return meta, metaFile, nil
+}
+
+func readLocalMeta(file string) (*localMeta, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &localMeta{}, nil
+		}
+		return nil, err
+	}
+	var meta localMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata in %s: %w", file, err)
+	}
+	return &meta, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it, so readers
+// never see a partially written object.
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
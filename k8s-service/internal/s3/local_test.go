@@ -0,0 +1,215 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalStorage", func() {
+	var (
+		client *s3.Client
+		server *httptest.Server
+		dir    string
+		gameID uuid.UUID
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		server = httptest.NewUnstartedServer(nil)
+
+		local := *cfg
+		local.StorageBackend = s3.BackendLocal
+		local.LocalStoragePath = dir
+		local.LocalStorageURL = "http://" + server.Listener.Addr().String()
+
+		var err error
+		client, err = s3.NewClient(&local, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Handler()).NotTo(BeNil())
+
+		server.Config.Handler = client.Handler()
+		server.Start()
+		DeferCleanup(server.Close)
+
+		gameID = uuid.New()
+	})
+
+	upload := func(upload *s3.PresignedUpload, headers http.Header, body []byte) int {
+		req, err := http.NewRequest(http.MethodPut, upload.URL, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header = headers
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	It("should upload and download a replay through presigned URLs", func() {
+		presigned, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatGzip, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presigned.URL).To(HavePrefix(server.URL + s3.LocalStoragePath + gameID.String() + "/replay.json.gz?"))
+		Expect(upload(presigned, presigned.Headers, []byte("replay"))).To(Equal(http.StatusOK))
+
+		replay, err := client.StatReplay(context.Background(), gameID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replay.Format).To(Equal(s3.ReplayFormatGzip))
+		Expect(replay.Size).To(Equal(int64(len("replay"))))
+		Expect(replay.ETag).NotTo(BeEmpty())
+
+		url, err := client.GeneratePresignedDownloadURL(context.Background(), replay, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		// Keep the client from decompressing the fake replay
+		raw := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+		resp, err := raw.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(resp.Header.Get("Content-Encoding")).To(Equal("gzip"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("replay"))
+	})
+
+	It("should accept plain JSON uploads with any headers", func() {
+		presigned, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatJSON, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presigned.Headers).To(BeEmpty())
+
+		Expect(upload(presigned, http.Header{"Content-Type": {"text/plain"}}, []byte("{}"))).To(Equal(http.StatusOK))
+
+		replay, err := client.StatReplay(context.Background(), gameID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replay.Format).To(Equal(s3.ReplayFormatJSON))
+	})
+
+	It("should reject uploads without the signed headers", func() {
+		presigned, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatGzip, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		headers := presigned.Headers.Clone()
+		headers.Del("Content-Encoding")
+		Expect(upload(presigned, headers, []byte("replay"))).To(Equal(http.StatusForbidden))
+
+		_, err = client.StatReplay(context.Background(), gameID)
+		Expect(err).To(MatchError(s3.ErrNotFound))
+	})
+
+	It("should reject tampered and expired URLs", func() {
+		presigned, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatJSON, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		tampered := &s3.PresignedUpload{URL: presigned.URL + "0", Headers: presigned.Headers}
+		Expect(upload(tampered, presigned.Headers, []byte("{}"))).To(Equal(http.StatusForbidden))
+
+		expired, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatJSON, -time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upload(expired, expired.Headers, []byte("{}"))).To(Equal(http.StatusForbidden))
+	})
+
+	It("should store logs and sweep them past their retention", func() {
+		Expect(client.UploadLogs(context.Background(), gameID, "bot-1", []byte("hello"), "queue")).To(Succeed())
+		Expect(client.ListLogContainers(context.Background(), gameID)).To(ConsistOf("bot-1"))
+		Expect(client.GetLogs(context.Background(), gameID, "bot-1")).To(Equal("hello"))
+
+		policy, err := s3.NewRetentionPolicy(`{"queue": {"logs": "1d"}}`, "default")
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := client.SweepExpired(context.Background(), policy, time.Now(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Objects).To(BeEmpty())
+
+		old := time.Now().Add(-48 * time.Hour)
+		Expect(os.Chtimes(filepath.Join(dir, gameID.String(), "logs", "bot-1.log"), old, old)).To(Succeed())
+
+		report, err = client.SweepExpired(context.Background(), policy, time.Now(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(Equal(1))
+		Expect(report.Objects[0].Class).To(Equal("queue"))
+		Expect(client.ListLogContainers(context.Background(), gameID)).To(BeEmpty())
+	})
+
+	Describe("replay retention", func() {
+		var policy *s3.RetentionPolicy
+
+		BeforeEach(func() {
+			var err error
+			policy, err = s3.NewRetentionPolicy(`{"final": {}, "queue": {"replay": "1d"}, "default": {"replay": "2d"}}`, "default")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		// uploadReplay uploads a replay like the game server and tags it with
+		// the class, if any, like the watcher once the game has finished.
+		uploadReplay := func(retentionClass string) uuid.UUID {
+			id := uuid.New()
+			presigned, err := client.GeneratePresignedUploadURL(id, s3.ReplayFormatJSON, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upload(presigned, presigned.Headers, []byte("{}"))).To(Equal(http.StatusOK))
+
+			if retentionClass != "" {
+				replay, err := client.StatReplay(context.Background(), id)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.TagReplayRetention(context.Background(), replay, retentionClass)).To(Succeed())
+			}
+			return id
+		}
+
+		exists := func(id uuid.UUID) bool {
+			_, err := client.StatReplay(context.Background(), id)
+			if errors.Is(err, s3.ErrNotFound) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return true
+		}
+
+		It("should sweep replays past the retention of their tagged class", func() {
+			final, queue, untagged := uploadReplay("final"), uploadReplay("queue"), uploadReplay("")
+
+			report, err := client.SweepExpired(context.Background(), policy, time.Now().Add(36*time.Hour), false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Deleted).To(Equal(1))
+			Expect(report.Objects).To(ConsistOf(And(
+				HaveField("Key", queue.String()+"/replay.json"),
+				HaveField("Kind", s3.ObjectKindReplay),
+				HaveField("Class", "queue"),
+			)))
+			Expect(exists(queue)).To(BeFalse())
+			Expect(exists(untagged)).To(BeTrue())
+
+			report, err = client.SweepExpired(context.Background(), policy, time.Now().Add(72*time.Hour), false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Objects).To(ConsistOf(HaveField("Class", "default")))
+			Expect(exists(untagged)).To(BeFalse())
+			Expect(exists(final)).To(BeTrue())
+		})
+
+		It("should only report expired replays in a dry run", func() {
+			queue := uploadReplay("queue")
+
+			report, err := client.SweepExpired(context.Background(), policy, time.Now().Add(36*time.Hour), true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.DryRun).To(BeTrue())
+			Expect(report.Deleted).To(BeZero())
+			Expect(report.Objects).To(ConsistOf(HaveField("Class", "queue")))
+			Expect(report.TotalSize).To(Equal(int64(len("{}"))))
+			Expect(exists(queue)).To(BeTrue())
+		})
+
+		It("should not tag replays that were not uploaded", func() {
+			replay := &s3.ReplayInfo{Key: gameID.String() + "/replay.json", Format: s3.ReplayFormatJSON}
+			Expect(client.TagReplayRetention(context.Background(), replay, "final")).To(MatchError(s3.ErrNotFound))
+		})
+	})
+})
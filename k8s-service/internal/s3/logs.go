@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+func logsPrefix(gameID uuid.UUID) string {
+	return fmt.Sprintf("%s/logs/", gameID.String())
+}
+
+func logsKey(gameID uuid.UUID, container string) string {
+	return logsPrefix(gameID) + container + ".log"
+}
+
+// UploadLogs stores the logs of a container of the game with the game's retention class.
+func (c *Client) UploadLogs(ctx context.Context, gameID uuid.UUID, container string, logs []byte, retentionClass string) error {
+	key := logsKey(gameID, container)
+
+	opts := PutOptions{
+		ContentType: "text/plain; charset=utf-8",
+	}
+	if retentionClass != "" {
+		opts.Metadata = map[string]string{retentionMetadataKey: retentionClass}
+	}
+	if err := c.storage.Put(ctx, key, logs, opts); err != nil {
+		return fmt.Errorf("failed to upload logs to %s: %w", key, err)
+	}
+
+	c.logger.Infof("Uploaded logs of container %s for game %s with key %s", container, gameID.String(), key)
+	return nil
+}
+
+// GetLogs returns the stored logs of a container of the game.
+func (c *Client) GetLogs(ctx context.Context, gameID uuid.UUID, container string) (string, error) {
+	key := logsKey(gameID, container)
+
+	logs, err := c.storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("logs of container %q: %w", container, ErrNotFound)
+		}
+		return "", fmt.Errorf("failed to read logs from %s: %w", key, err)
+	}
+	return string(logs), nil
+}
+
+// ListLogContainers returns the names of all containers of the game with stored logs.
+func (c *Client) ListLogContainers(ctx context.Context, gameID uuid.UUID) ([]string, error) {
+	objects, err := c.storage.List(ctx, logsPrefix(gameID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logs: %w", err)
+	}
+
+	var containers []string
+	for _, obj := range objects {
+		containers = append(containers, strings.TrimSuffix(path.Base(obj.Key), ".log"))
+	}
+	return containers, nil
+}
@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"go.uber.org/zap"
+)
+
+// MinioStorage stores objects in an S3-compatible bucket.
+type MinioStorage struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ Storage = (*MinioStorage)(nil)
+
+func NewMinioStorage(cfg *config.Config, logger *zap.SugaredLogger) (*MinioStorage, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretKey == "" {
+		return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 storage backend")
+	}
+	endpoint, secure := parseEndpoint(cfg.S3Endpoint, cfg.S3Bucket)
+
+	cli, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKeyID, cfg.S3SecretKey, ""),
+		Secure: secure,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	_, err = cli.HealthCheck(time.Second * 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check S3 health: %w", err)
+	}
+	logger.Infoln("Successfully created S3 client with health check")
+
+	return &MinioStorage{
+		client: cli,
+		bucket: cfg.S3Bucket,
+	}, nil
+}
+
+func (s *MinioStorage) PresignPut(ctx context.Context, key string, expiry time.Duration, headers http.Header) (string, error) {
+	presignedURL, err := s.client.PresignHeader(ctx, http.MethodPut, s.bucket, key, expiry, nil, headers)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *MinioStorage) PresignGet(ctx context.Context, key string, expiry time.Duration, params url.Values) (string, error) {
+	presignedURL, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *MinioStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size,
+		ETag:         strings.Trim(info.ETag, `"`),
+		LastModified: info.LastModified,
+		Metadata:     info.UserMetadata,
+	}, nil
+}
+
+func (s *MinioStorage) Put(ctx context.Context, key string, data []byte, opts PutOptions) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.Metadata,
+	})
+	return err
+}
+
+func (s *MinioStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *MinioStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			ETag:         strings.Trim(obj.ETag, `"`),
+			LastModified: obj.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (s *MinioStorage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *MinioStorage) SetTags(ctx context.Context, key string, objectTags map[string]string) error {
+	t, err := tags.NewTags(objectTags, true)
+	if err != nil {
+		return err
+	}
+	err = s.client.PutObjectTagging(ctx, s.bucket, key, t, minio.PutObjectTaggingOptions{})
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return err
+}
+
+func (s *MinioStorage) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	t, err := s.client.GetObjectTagging(ctx, s.bucket, key, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return t.ToMap(), nil
+}
+
+// parseEndpoint returns a clean endpoint host:port and whether to use TLS (https)
+// It also strips any accidental bucket prefix in the provided endpoint path to avoid
+// double-bucket paths on S3-compatible services like StackIT.
+func parseEndpoint(ep, bucket string) (endpoint string, secure bool) {
+	if ep == "" {
+		return ep, true
+	}
+	// If scheme is missing, assume https
+	if !strings.HasPrefix(ep, "http://") && !strings.HasPrefix(ep, "https://") {
+		ep = "https://" + ep
+	}
+
+	u, err := url.Parse(ep)
+	if err != nil {
+		// Fall back to given string without scheme; default secure true
+		return strings.TrimPrefix(strings.TrimPrefix(ep, "https://"), "http://"), true
+	}
+
+	secure = u.Scheme == "https"
+
+	// Normalize path: drop leading bucket segment if present
+	trimmed := strings.Trim(u.Path, "/")
+	if trimmed != "" {
+		segs := strings.Split(trimmed, "/")
+		if len(segs) > 0 && bucket != "" && segs[0] == bucket {
+			segs = segs[1:]
+		}
+		if len(segs) == 0 {
+			u.Path = ""
+		} else {
+			u.Path = "/" + strings.Join(segs, "/")
+		}
+	}
+
+	// MinIO expects endpoint without scheme and without path; keep only host[:port]
+	return u.Host, secure
+}
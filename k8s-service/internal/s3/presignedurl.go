@@ -3,20 +3,33 @@ package s3
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func (c *Client) GeneratePresignedUploadURL(gameID uuid.UUID) (string, error) {
-	key := fmt.Sprintf("%s/replay.json", gameID.String())
+// PresignedUpload is where and how the game server uploads a replay.
+type PresignedUpload struct {
+	URL string
+	// Headers have to be sent with the upload, the signature covers them.
+	Headers http.Header
+}
+
+// GeneratePresignedUploadURL returns a URL the game server uploads the replay
+// to in the given format. It has to stay valid until the game has finished.
+func (c *Client) GeneratePresignedUploadURL(gameID uuid.UUID, format ReplayFormat, expiry time.Duration) (*PresignedUpload, error) {
+	key := replayKey(gameID, format)
+	headers := format.uploadHeaders()
 
-	expiry := 1 * time.Hour
-	presignedURL, err := c.s3Client.PresignedPutObject(context.Background(), c.bucket, key, expiry)
+	presignedURL, err := c.storage.PresignPut(context.Background(), key, expiry, headers)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
 
 	c.logger.Infof("Generated presigned URL for game %s with key %s", gameID.String(), key)
-	return presignedURL.String(), nil
+	return &PresignedUpload{
+		URL:     presignedURL,
+		Headers: headers,
+	}, nil
 }
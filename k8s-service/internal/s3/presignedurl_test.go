@@ -1,6 +1,10 @@
 package s3_test
 
 import (
+	"context"
+	"net/url"
+	"time"
+
 	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
@@ -12,7 +16,7 @@ var _ = Describe("Presignedurl", func() {
 
 	BeforeEach(func() {
 		var err error
-		client, err = s3.NewS3Client(cfg, logger)
+		client, err = s3.NewClient(cfg, logger)
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(client).NotTo(BeNil())
@@ -21,9 +25,50 @@ var _ = Describe("Presignedurl", func() {
 	It("should create a Presigned URL", func() {
 		gameID := uuid.New()
 
-		url, err := client.GeneratePresignedUploadURL(gameID)
+		upload, err := client.GeneratePresignedUploadURL(gameID, s3.ReplayFormatJSON, time.Hour)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upload.URL).To(ContainSubstring(gameID.String() + "/replay.json?"))
+	})
+
+	DescribeTable("should sign the headers of each format",
+		func(format s3.ReplayFormat, key string, headers map[string]string, signed string) {
+			gameID := uuid.New()
+
+			upload, err := client.GeneratePresignedUploadURL(gameID, format, time.Hour)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upload.URL).To(ContainSubstring(gameID.String() + "/" + key + "?"))
+			Expect(upload.Headers).To(HaveLen(len(headers)))
+			for name, value := range headers {
+				Expect(upload.Headers.Get(name)).To(Equal(value))
+			}
+			parsed, err := url.Parse(upload.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Query().Get("X-Amz-SignedHeaders")).To(Equal(signed))
+		},
+		Entry("json", s3.ReplayFormatJSON, "replay.json", map[string]string{}, "host"),
+		Entry("gzip", s3.ReplayFormatGzip, "replay.json.gz",
+			map[string]string{"Content-Type": "application/json", "Content-Encoding": "gzip"}, "content-encoding;content-type;host"),
+		Entry("zstd", s3.ReplayFormatZstd, "replay.json.zst",
+			map[string]string{"Content-Type": "application/json", "Content-Encoding": "zstd"}, "content-encoding;content-type;host"),
+	)
+
+	It("should create a Presigned download URL for the replay", func() {
+		gameID := uuid.New()
+		replay := &s3.ReplayInfo{Key: gameID.String() + "/replay.json.gz", Format: s3.ReplayFormatGzip}
+
+		downloadURL, err := client.GeneratePresignedDownloadURL(context.Background(), replay, 15*time.Minute)
 
 		Expect(err).NotTo(HaveOccurred())
-		Expect(url).NotTo(BeEmpty())
+		Expect(downloadURL).To(ContainSubstring(gameID.String() + "/replay.json.gz"))
+		Expect(downloadURL).To(ContainSubstring("X-Amz-Expires=900"))
+		Expect(downloadURL).To(ContainSubstring("response-content-encoding=gzip"))
+		Expect(downloadURL).To(ContainSubstring("response-content-type=application%2Fjson"))
+	})
+
+	It("should reject unknown replay formats", func() {
+		_, err := s3.ParseReplayFormat("brotli")
+		Expect(err).To(MatchError(s3.ErrUnknownReplayFormat))
 	})
 })
@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReplayFormat is the encoding a replay is uploaded in.
+type ReplayFormat string
+
+// Supported replay formats. The format is encoded in the object key.
+const (
+	ReplayFormatJSON ReplayFormat = "json"
+	ReplayFormatGzip ReplayFormat = "gzip"
+	ReplayFormatZstd ReplayFormat = "zstd"
+)
+
+// ErrUnknownReplayFormat is returned for replay formats other than the supported ones.
+var ErrUnknownReplayFormat = errors.New("unknown replay format")
+
+const replayContentType = "application/json"
+
+// replayFormats lists the supported formats in the order they are looked up.
+var replayFormats = []ReplayFormat{ReplayFormatZstd, ReplayFormatGzip, ReplayFormatJSON}
+
+// ParseReplayFormat returns the format with the given name, or
+// ErrUnknownReplayFormat.
+func ParseReplayFormat(name string) (ReplayFormat, error) {
+	format := ReplayFormat(name)
+	switch format {
+	case ReplayFormatJSON, ReplayFormatGzip, ReplayFormatZstd:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownReplayFormat, name)
+	}
+}
+
+// ContentEncoding returns the Content-Encoding of the format, or "" for plain JSON.
+func (f ReplayFormat) ContentEncoding() string {
+	switch f {
+	case ReplayFormatGzip:
+		return "gzip"
+	case ReplayFormatZstd:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+func (f ReplayFormat) extension() string {
+	switch f {
+	case ReplayFormatGzip:
+		return ".gz"
+	case ReplayFormatZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// uploadHeaders returns the headers an upload in this format has to be sent
+// with. Plain JSON is uploaded without any, like before compressed formats
+// existed.
+func (f ReplayFormat) uploadHeaders() http.Header {
+	headers := http.Header{}
+	if encoding := f.ContentEncoding(); encoding != "" {
+		headers.Set("Content-Type", replayContentType)
+		headers.Set("Content-Encoding", encoding)
+	}
+	return headers
+}
+
+// ReplayInfo describes an uploaded replay.
+type ReplayInfo struct {
+	Key        string
+	Format     ReplayFormat
+	Size       int64
+	ETag       string
+	UploadedAt time.Time
+}
+
+func replayKey(gameID uuid.UUID, format ReplayFormat) string {
+	return fmt.Sprintf("%s/replay.json%s", gameID.String(), format.extension())
+}
+
+// StatReplay returns the metadata of the game's replay in whichever format it
+// was uploaded, or ErrNotFound if the game server has not uploaded it yet.
+func (c *Client) StatReplay(ctx context.Context, gameID uuid.UUID) (*ReplayInfo, error) {
+	objects, err := c.storage.List(ctx, replayKey(gameID, ReplayFormatJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replays of game %s: %w", gameID.String(), err)
+	}
+	byKey := make(map[string]ObjectInfo, len(objects))
+	for _, obj := range objects {
+		byKey[obj.Key] = obj
+	}
+
+	for _, format := range replayFormats {
+		key := replayKey(gameID, format)
+		if obj, ok := byKey[key]; ok {
+			return &ReplayInfo{
+				Key:        key,
+				Format:     format,
+				Size:       obj.Size,
+				ETag:       obj.ETag,
+				UploadedAt: obj.LastModified,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("replay of game %s: %w", gameID.String(), ErrNotFound)
+}
+
+// TagReplayRetention tags the uploaded replay with its retention class, or
+// returns ErrNotFound.
+func (c *Client) TagReplayRetention(ctx context.Context, replay *ReplayInfo, retentionClass string) error {
+	if err := c.storage.SetTags(ctx, replay.Key, map[string]string{retentionTag: retentionClass}); err != nil {
+		return fmt.Errorf("failed to tag replay %s: %w", replay.Key, err)
+	}
+	return nil
+}
+
+// GeneratePresignedDownloadURL returns a URL to download the replay that is
+// valid for the given duration. The response carries the replay's
+// Content-Type and Content-Encoding, so browsers decompress it transparently.
+func (c *Client) GeneratePresignedDownloadURL(ctx context.Context, replay *ReplayInfo, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-type", replayContentType)
+	if encoding := replay.Format.ContentEncoding(); encoding != "" {
+		params.Set("response-content-encoding", encoding)
+	}
+
+	presignedURL, err := c.storage.PresignGet(ctx, replay.Key, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned download URL: %w", err)
+	}
+	return presignedURL, nil
+}
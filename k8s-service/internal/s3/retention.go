@@ -0,0 +1,233 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionMetadataKey is the user metadata (x-amz-meta-retention) holding
+// the retention class of objects k8s-service uploads itself, like logs.
+const retentionMetadataKey = "Retention"
+
+// retentionTag is the object tag holding the retention class of replays. The
+// game server uploads them, so the class is tagged afterwards.
+const retentionTag = "retention"
+
+const metadataHeaderPrefix = "X-Amz-Meta-"
+
+// ObjectKind is the kind of data an object in the bucket holds.
+type ObjectKind string
+
+const (
+	ObjectKindReplay ObjectKind = "replay"
+	ObjectKindLogs   ObjectKind = "logs"
+)
+
+// RetentionRule is how long the objects of a retention class are kept, per
+// kind. Durations are given like "168h" or "30d"; empty keeps them forever.
+type RetentionRule struct {
+	Replay string `json:"replay,omitempty"`
+	Logs   string `json:"logs,omitempty"`
+}
+
+// RetentionPolicy maps retention classes to how long their objects are kept.
+// Objects of classes without a rule are kept forever.
+type RetentionPolicy struct {
+	defaultClass string
+	maxAges      map[string]map[ObjectKind]time.Duration
+}
+
+// NewRetentionPolicy parses the retention rules given as JSON in the
+// configuration, keyed by retention class. Objects without a class are
+// treated as defaultClass.
+func NewRetentionPolicy(policiesJSON, defaultClass string) (*RetentionPolicy, error) {
+	policy := &RetentionPolicy{
+		defaultClass: defaultClass,
+		maxAges:      map[string]map[ObjectKind]time.Duration{},
+	}
+	if policiesJSON == "" {
+		return policy, nil
+	}
+
+	var rules map[string]RetentionRule
+	if err := json.Unmarshal([]byte(policiesJSON), &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse retention policies: %w", err)
+	}
+	for class, rule := range rules {
+		maxAges := map[ObjectKind]time.Duration{}
+		for kind, value := range map[ObjectKind]string{ObjectKindReplay: rule.Replay, ObjectKindLogs: rule.Logs} {
+			if value == "" {
+				continue
+			}
+			maxAge, err := parseRetention(value)
+			if err != nil {
+				return nil, fmt.Errorf("retention class %q %s: %w", class, kind, err)
+			}
+			maxAges[kind] = maxAge
+		}
+		policy.maxAges[class] = maxAges
+	}
+	return policy, nil
+}
+
+// DefaultClass is the class of objects uploaded without one.
+func (p *RetentionPolicy) DefaultClass() string {
+	return p.defaultClass
+}
+
+// maxAge returns how long objects of the class and kind are kept, and false
+// if they are kept forever.
+func (p *RetentionPolicy) maxAge(class string, kind ObjectKind) (time.Duration, bool) {
+	maxAge, ok := p.maxAges[class][kind]
+	return maxAge, ok
+}
+
+// minMaxAge returns the shortest retention of the kind across all classes.
+// Younger objects are never expired and do not need to be inspected.
+func (p *RetentionPolicy) minMaxAge(kind ObjectKind) (time.Duration, bool) {
+	var (
+		min   time.Duration
+		found bool
+	)
+	for _, maxAges := range p.maxAges {
+		if maxAge, ok := maxAges[kind]; ok && (!found || maxAge < min) {
+			min, found = maxAge, true
+		}
+	}
+	return min, found
+}
+
+// parseRetention parses a Go duration, additionally accepting whole days like "30d".
+func parseRetention(value string) (time.Duration, error) {
+	var (
+		maxAge time.Duration
+		err    error
+	)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		maxAge = time.Duration(n) * 24 * time.Hour
+	} else {
+		maxAge, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", value)
+	}
+	return maxAge, nil
+}
+
+// objectKind derives the kind of an object from its key.
+func objectKind(key string) (ObjectKind, bool) {
+	switch {
+	case strings.Contains(key, "/logs/"):
+		return ObjectKindLogs, true
+	case strings.HasPrefix(path.Base(key), "replay.json"):
+		return ObjectKindReplay, true
+	default:
+		return "", false
+	}
+}
+
+// ExpiredObject is an object past its retention.
+type ExpiredObject struct {
+	Key          string
+	Kind         ObjectKind
+	Class        string
+	Size         int64
+	LastModified time.Time
+	ExpiredAt    time.Time
+}
+
+// RetentionReport lists the objects a sweep deleted, or would delete in a dry run.
+type RetentionReport struct {
+	GeneratedAt time.Time
+	DryRun      bool
+	Objects     []ExpiredObject
+	TotalSize   int64
+	// Deleted is the number of objects actually removed.
+	Deleted int
+}
+
+// SweepExpired finds all objects past the retention of their class and
+// deletes them, unless dryRun is set.
+func (c *Client) SweepExpired(ctx context.Context, policy *RetentionPolicy, now time.Time, dryRun bool) (*RetentionReport, error) {
+	report := &RetentionReport{
+		GeneratedAt: now,
+		DryRun:      dryRun,
+		Objects:     []ExpiredObject{},
+	}
+
+	objects, err := c.storage.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	for _, obj := range objects {
+		kind, ok := objectKind(obj.Key)
+		if !ok {
+			continue
+		}
+		if minAge, ok := policy.minMaxAge(kind); !ok || now.Sub(obj.LastModified) < minAge {
+			continue
+		}
+
+		info, err := c.storage.Stat(ctx, obj.Key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat %s: %w", obj.Key, err)
+		}
+		class := info.Metadata[retentionMetadataKey]
+		if class == "" {
+			objectTags, err := c.storage.GetTags(ctx, obj.Key)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get tags of %s: %w", obj.Key, err)
+			}
+			class = objectTags[retentionTag]
+		}
+		if class == "" {
+			class = policy.DefaultClass()
+		}
+
+		maxAge, ok := policy.maxAge(class, kind)
+		if !ok || now.Sub(obj.LastModified) < maxAge {
+			continue
+		}
+
+		report.Objects = append(report.Objects, ExpiredObject{
+			Key:          obj.Key,
+			Kind:         kind,
+			Class:        class,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ExpiredAt:    obj.LastModified.Add(maxAge),
+		})
+		report.TotalSize += obj.Size
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, obj := range report.Objects {
+		if err := c.storage.Delete(ctx, obj.Key); err != nil {
+			return report, fmt.Errorf("failed to delete %s: %w", obj.Key, err)
+		}
+		report.Deleted++
+	}
+	c.logger.Infof("Deleted %d expired objects (%d bytes)", report.Deleted, report.TotalSize)
+	return report, nil
+}
@@ -0,0 +1,35 @@
+package s3_test
+
+import (
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retention", func() {
+	It("should accept durations and whole days", func() {
+		policy, err := s3.NewRetentionPolicy(`{"queue": {"replay": "30d", "logs": "168h"}, "final": {}}`, "queue")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.DefaultClass()).To(Equal("queue"))
+	})
+
+	It("should keep everything without policies", func() {
+		policy, err := s3.NewRetentionPolicy("", "default")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.DefaultClass()).To(Equal("default"))
+	})
+
+	DescribeTable("should reject invalid policies",
+		func(policies string) {
+			_, err := s3.NewRetentionPolicy(policies, "default")
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("malformed JSON", `{"queue":`),
+		Entry("invalid duration", `{"queue": {"replay": "a month"}}`),
+		Entry("invalid days", `{"queue": {"logs": "xd"}}`),
+		Entry("zero duration", `{"queue": {"logs": "0d"}}`),
+		Entry("negative duration", `{"queue": {"replay": "-1h"}}`),
+	)
+})
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/42core-team/website_relaunch/k8s-service/internal/config"
+	"github.com/42core-team/website_relaunch/k8s-service/internal/s3"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/zap"
@@ -18,7 +19,14 @@ func TestS3(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
-	cfg = config.ReadConfig()
+	cfg = &config.Config{
+		StorageBackend: s3.BackendS3,
+		S3Endpoint:     "http://localhost:9000",
+		S3Region:       "eu",
+		S3Bucket:       "core-replays",
+		S3AccessKeyID:  "test",
+		S3SecretKey:    "test-secret",
+	}
 
 	prodLogger, err := zap.NewProduction()
 	Expect(err).ShouldNot(HaveOccurred())